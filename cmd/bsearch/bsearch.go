@@ -16,16 +16,29 @@ import (
 	log "github.com/rs/zerolog/log"
 )
 
+// Number of SearchStrings to look up at a time with --sorted
+const sortedBatchSize = 10000
+
+// Whether to reverse SearchStrings and output lines (see setRev)
+var revKeys, revLines bool
+
 // Options
 var opts struct {
 	Verbose []bool `short:"v" long:"verbose" description:"display verbose debug output"`
 	Header  bool   `short:"H" long:"hdr" description:"ignore first line (header) in Filename when doing lookups"`
-	Rev     bool   `short:"r" long:"rev" description:"reverse SearchString for search, and reverse output lines when printing"`
+	Rev     bool   `short:"r" long:"rev" description:"reverse SearchString for search, and reverse output lines when printing (implied for datasets indexed with --rev)"`
 	Stdin   bool   `short:"c" long:"stdin" description:"read SearchStrings from standard input instead of command line"`
+	Sorted  bool   `short:"s" long:"sorted" description:"with --stdin, SearchStrings are sorted, so look them up in a single pass (much faster)"`
+	Prefix  bool   `short:"p" long:"prefix" description:"return all lines with keys beginning with SearchString, instead of exact key matches"`
+	Glob    bool   `short:"g" long:"glob" description:"return all lines with keys matching SearchString as a shell glob pattern (e.g. 'alstom.c*'), matched against keys as stored (i.e. reversed, for datasets indexed with --rev)"`
+	Regex   bool   `short:"e" long:"regex" description:"return all lines matching SearchString as a regular expression (anchor with '^' for a fast indexed search), matched against lines as stored"`
+	Context int    `short:"C" long:"context" description:"also print up to CONTEXT lines before and after matches (or if none, around a '--> SearchString <--' marker line)"`
+	From    string `long:"from" description:"return all lines with keys greater-than-or-equal-to FROM (replaces SearchString)"`
+	To      string `long:"to" description:"return all lines with keys less-than TO (replaces SearchString)"`
 	Args    struct {
 		SearchString string
 		Filename     string
-	} `positional-args:"yes" required:"yes"`
+	} `positional-args:"yes"`
 }
 
 // Disable flags.PrintErrors for more control
@@ -57,6 +70,34 @@ func main() {
 		usage()
 	}
 
+	// With --from/--to or --stdin, SearchString is omitted
+	rangeMode := opts.From != "" || opts.To != ""
+	if (rangeMode || opts.Stdin) && opts.Args.Filename == "" {
+		opts.Args.Filename = opts.Args.SearchString
+		opts.Args.SearchString = ""
+	}
+	if opts.Args.Filename == "" {
+		fmt.Fprintf(os.Stderr, "the required argument `Filename` was not provided\n\n")
+		usage()
+	}
+	patternMode := opts.Prefix || opts.Glob || opts.Regex
+	if (opts.Prefix && opts.Glob) || (opts.Prefix && opts.Regex) || (opts.Glob && opts.Regex) {
+		fmt.Fprintf(os.Stderr, "only one of --prefix, --glob, and --regex may be used\n\n")
+		usage()
+	}
+	if opts.Rev && (opts.Glob || opts.Regex) {
+		fmt.Fprintf(os.Stderr, "--rev cannot be used with --glob or --regex (patterns match keys as stored)\n\n")
+		usage()
+	}
+	if opts.Sorted && (!opts.Stdin || patternMode) {
+		fmt.Fprintf(os.Stderr, "--sorted requires --stdin, and cannot be used with --prefix, --glob, or --regex\n\n")
+		usage()
+	}
+	if opts.Context > 0 && (opts.Sorted || patternMode || rangeMode) {
+		fmt.Fprintf(os.Stderr, "--context cannot be used with --sorted, --prefix, --glob, --regex, --from, or --to\n\n")
+		usage()
+	}
+
 	// Setup
 	switch len(opts.Verbose) {
 	case 0:
@@ -95,6 +136,30 @@ func main() {
 			Str("path", idxpath).
 			Msg("using index")
 	}
+	setRev(bss)
+
+	if rangeMode {
+		var start, end []byte
+		if opts.From != "" {
+			start = []byte(revKey(opts.From))
+		}
+		if opts.To != "" {
+			end = []byte(revKey(opts.To))
+		}
+		it := bss.Range(start, end)
+		for it.Next() {
+			fmt.Println(revLine(string(it.Line())))
+		}
+		if err := it.Err(); err != nil {
+			die("Error: " + err.Error())
+		}
+		os.Exit(0)
+	}
+
+	if opts.Stdin && opts.Sorted {
+		lookupSorted(bss, bufio.NewReader(os.Stdin))
+		os.Exit(0)
+	}
 
 	if opts.Stdin {
 		reader := bufio.NewReader(os.Stdin)
@@ -107,12 +172,19 @@ func main() {
 				die(err.Error())
 			}
 
-			searchStr := strings.Trim(string(lineBytes), "\n")
-			if opts.Rev {
-				searchStr = reverse(searchStr)
+			input := strings.Trim(string(lineBytes), "\n")
+			searchStr := revKey(input)
+
+			if opts.Context > 0 {
+				err = printContext(bss, searchStr, input)
+				if err != nil {
+					die(err.Error())
+				}
+				fmt.Println()
+				continue
 			}
 
-			results, err := bss.Lines([]byte(searchStr))
+			results, err := lookup(bss, searchStr)
 			if err == bsearch.ErrNotFound {
 				fmt.Println()
 				continue
@@ -121,12 +193,7 @@ func main() {
 			}
 
 			for _, r := range results {
-				rs := string(r)
-				if opts.Rev {
-					fmt.Println(reverse(rs))
-				} else {
-					fmt.Println(rs)
-				}
+				fmt.Println(revLine(string(r)))
 			}
 
 			//
@@ -138,13 +205,18 @@ func main() {
 		os.Exit(0)
 	}
 
-	searchStr := opts.Args.SearchString
-	if opts.Rev {
-		searchStr = reverse(searchStr)
+	searchStr := revKey(opts.Args.SearchString)
+
+	if opts.Context > 0 {
+		err = printContext(bss, searchStr, opts.Args.SearchString)
+		if err != nil {
+			die("Error: " + err.Error())
+		}
+		os.Exit(0)
 	}
 
 	// Search
-	results, err := bss.Lines([]byte(searchStr))
+	results, err := lookup(bss, searchStr)
 	if err != nil {
 		if err == bsearch.ErrIndexNotFound {
 			die("Error: compressed dataset without index - recompress using bsearch_compress.")
@@ -152,14 +224,131 @@ func main() {
 		die("Error: " + err.Error())
 	}
 	for _, l := range results {
-		var line string
-		if opts.Rev {
-			line = reverse(string(l))
-		} else {
-			line = string(l)
+		fmt.Println(revLine(string(l)))
+	}
+}
+
+// lookup returns the lines from bss matching searchStr, using prefix, glob,
+// or regexp matching if --prefix, --glob, or --regex is set, and exact key
+// matching otherwise.
+func lookup(bss *bsearch.Searcher, searchStr string) ([][]byte, error) {
+	switch {
+	case opts.Prefix:
+		return bss.PrefixLines([]byte(searchStr), 0)
+	case opts.Glob:
+		return bss.Glob([]byte(searchStr))
+	case opts.Regex:
+		re, err := regexp.Compile(searchStr)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Println(line)
+		return bss.Regexp(re)
+	}
+	return bss.Lines([]byte(searchStr))
+}
+
+// printContext prints the lines from bss matching searchStr (as for
+// lookup), preceded and followed by up to --context neighbouring lines.
+// If there are no matching lines, a marker line is printed instead, showing
+// where input (the unreversed searchStr) would have sorted.
+func printContext(bss *bsearch.Searcher, searchStr, input string) error {
+	before, after, err := bss.Neighbors([]byte(searchStr), opts.Context, opts.Context)
+	if err != nil {
+		return err
+	}
+	results, err := bss.Lines([]byte(searchStr))
+	if err != nil && err != bsearch.ErrNotFound {
+		return err
+	}
+
+	for _, l := range before {
+		fmt.Println(revLine(string(l)))
+	}
+	if len(results) == 0 {
+		fmt.Printf("--> %s <--\n", input)
+	}
+	for _, l := range results {
+		fmt.Println(revLine(string(l)))
+	}
+	for _, l := range after {
+		fmt.Println(revLine(string(l)))
+	}
+	return nil
+}
+
+// lookupSorted reads sorted SearchStrings from reader and looks them up
+// in batches using bss.LookupMany, printing the results (as for --stdin)
+func lookupSorted(bss *bsearch.Searcher, reader *bufio.Reader) {
+	batch := make([][]byte, 0, sortedBatchSize)
+	flush := func() {
+		err := bss.LookupMany(batch, func(key []byte, lines [][]byte) bool {
+			for _, l := range lines {
+				fmt.Println(revLine(string(l)))
+			}
+			//
+			// Nb. blank line means no more results
+			//
+			fmt.Println()
+			return true
+		})
+		if err != nil {
+			die(err.Error())
+		}
+		batch = batch[:0]
+	}
+
+	var prevKey []byte
+	for {
+		lineBytes, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			die(err.Error())
+		}
+
+		key := []byte(revKey(strings.Trim(string(lineBytes), "\n")))
+
+		// Input must be in dataset order (i.e. by reversed key, for
+		// KeysReversed datasets, and using the index Comparator)
+		sortKey := key
+		if bss.Index.KeysReversed {
+			sortKey = []byte(reverse(string(key)))
+		}
+		if prevKey != nil && bss.Index.Compare(sortKey, prevKey) < 0 {
+			die(fmt.Sprintf("Unsorted input? SearchString %q < %q", sortKey, prevKey))
+		}
+		prevKey = sortKey
+
+		batch = append(batch, key)
+		if len(batch) == sortedBatchSize {
+			flush()
+		}
+	}
+	flush()
+}
+
+// setRev sets revKeys and revLines for bss. SearchStrings are reversed
+// here for --rev, unless bss's index is KeysReversed, in which case bss
+// reverses them itself. Output lines are reversed for either.
+func setRev(bss *bsearch.Searcher) {
+	revKeys = opts.Rev && !bss.Index.KeysReversed
+	revLines = opts.Rev || bss.Index.KeysReversed
+}
+
+// revKey returns s reversed if revKeys is set, and s unchanged otherwise.
+func revKey(s string) string {
+	if revKeys {
+		return reverse(s)
+	}
+	return s
+}
+
+// revLine returns s reversed if revLines is set, and s unchanged otherwise.
+func revLine(s string) string {
+	if revLines {
+		return reverse(s)
 	}
+	return s
 }
 
 // reverse returns its argument string reversed rune-wise left to right.
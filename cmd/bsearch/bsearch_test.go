@@ -2,10 +2,13 @@ package main
 
 import (
 	"flag"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/ProfoundNetworks/bsearch"
 )
 
 var update *bool
@@ -42,6 +45,33 @@ func TestCmdBsearch(t *testing.T) {
 032.176.184.000,mobile005.mycingular.net,202003,mycingular.net`},
 		{"223.252.003.000", "223.252.003.000", "",
 			"223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net"},
+		{"--prefix 001.0", "--prefix", "001.0",
+			`001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net
+001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net
+001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au
+001.065.117.000,1-65-117-000.static.netvigator.com,202003,netvigator.com
+001.079.088.000,sp1-79-88-0.msb.spmode.ne.jp,202003,spmode.ne.jp`},
+		{"--from 001.034 --to 001.066", "--from 001.034 --to 001.066", "",
+			`001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net
+001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au
+001.065.117.000,1-65-117-000.static.netvigator.com,202003,netvigator.com`},
+		{"--from 223.220", "--from 223.220", "",
+			"223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net"},
+		{"--context 1 001.040.000.000", "--context 1", "001.040.000.000",
+			`001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net
+--> 001.040.000.000 <--
+001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au`},
+		{"-C 1 001.034.164.000", "-C 1", "001.034.164.000",
+			`001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net
+001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net
+001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au`},
+		{"--glob 001.0[0-4]*", "--glob", "'001.0[0-4]*'",
+			`001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net
+001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net
+001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au`},
+		{"--regex ^001\\..*\\.au$", "--regex", "'^001\\..*\\.au$'",
+			`001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au
+001.123.104.000,cpe-1-223-104-0.bpi3-r-032.fli.sa.bigpond.net.au,202003,bigpond.net.au`},
 	}
 
 	infile := filepath.Join("..", "..", "testdata", "rdns1.csv")
@@ -61,6 +91,84 @@ func TestCmdBsearch(t *testing.T) {
 	}
 }
 
+func TestCmdBsearchStdinSorted(t *testing.T) {
+	var tests = []struct {
+		name   string
+		args   string
+		input  string
+		expect string
+	}{
+		{"--stdin", "--stdin", "032.176.184.000\n001.000.000.000\n001.034.164.000\n",
+			`032.176.184.000,mobile000.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile001.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile002.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile003.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile004.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile005.mycingular.net,202003,mycingular.net
+
+
+001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net`},
+		{"--stdin --sorted", "--stdin --sorted", "001.000.000.000\n001.034.164.000\n032.176.184.000\n",
+			`001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net
+
+032.176.184.000,mobile000.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile001.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile002.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile003.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile004.mycingular.net,202003,mycingular.net
+032.176.184.000,mobile005.mycingular.net,202003,mycingular.net`},
+	}
+
+	infile := filepath.Join("..", "..", "testdata", "rdns1.csv")
+
+	for _, tc := range tests {
+		cmd := exec.Command("bash", "-c", "./bsearch "+tc.args+" "+infile)
+		cmd.Stdin = strings.NewReader(tc.input)
+		output, err := cmd.CombinedOutput()
+		got := strings.TrimSpace(string(output))
+		if err != nil {
+			t.Fatalf("%s: %s", err.Error(), got)
+		}
+
+		if got != tc.expect {
+			t.Errorf("test %q stdin test failed:\n\ngot:\n%s\n\nexpected:\n%s\n", tc.name, got, tc.expect)
+		}
+	}
+}
+
+// Test --stdin --sorted input order is checked using the index Comparator
+func TestCmdBsearchStdinSortedNumeric(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "numeric.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infile := filepath.Join(t.TempDir(), "numeric.csv")
+	err = os.WriteFile(infile, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := bsearch.NewIndexOptions(infile, bsearch.IndexOptions{Comparator: bsearch.Numeric})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("bash", "-c", "./bsearch --stdin --sorted "+infile)
+	cmd.Stdin = strings.NewReader("-3\n2\n10\n100\n")
+	output, err := cmd.CombinedOutput()
+	got := strings.TrimSpace(string(output))
+	if err != nil {
+		t.Fatalf("%s: %s", err.Error(), got)
+	}
+	expect := "-3,neg\n\n2,two\n\n10,ten\n10.0,ten-point-oh\n\n100,hundred"
+	if got != expect {
+		t.Errorf("numeric stdin test failed:\n\ngot:\n%s\n\nexpected:\n%s\n", got, expect)
+	}
+}
+
 /*
 // FIXME: these are non-terminated text files - revisit
 func TestRev(t *testing.T) {
@@ -167,3 +275,20 @@ www.ed1000.ca`},
 	}
 }
 */
+
+func TestRevPatterns(t *testing.T) {
+	infile := filepath.Join("testdata", "ca_rev.txt")
+
+	for _, args := range []string{"--glob 'ac.0-0*'", "--regex '^ac.0-0'"} {
+		cmd := "./bsearch -r " + args + " " + infile
+
+		output, err := exec.Command("bash", "-c", cmd).CombinedOutput()
+		got := string(output)
+		if err == nil {
+			t.Errorf("%q: expected an error, got:\n%s", args, got)
+		}
+		if !strings.Contains(got, "--rev cannot be used with --glob or --regex") {
+			t.Errorf("%q: unexpected output:\n%s", args, got)
+		}
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/ProfoundNetworks/bsearch"
 	flags "github.com/jessevdk/go-flags"
@@ -23,8 +25,21 @@ import (
 // Options
 var opts struct {
 	Verbose   []bool `short:"v" long:"verbose" description:"display verbose debug output"`
-	Delim     string `short:"t" long:"sep" description:"separator/delimiter character"`
+	Delim     string `short:"t" long:"sep" unquote:"false" description:"separator/delimiter character or string (backslash escapes like \\t or \\x1f are interpreted)"`
+	Compare   string `long:"cmp" description:"key comparator the dataset is sorted with: bytes (default), casefold (sort -f), numeric (sort -n), general (sort -g), or collate:TAG for Unicode collation (e.g. collate:en)"`
+	Quote     string `short:"q" long:"quote" unquote:"false" description:"quote character for quoted fields (e.g. '\"'), whose keys are searched unquoted"`
+	Escape    string `long:"escape" unquote:"false" description:"escape character for quotes within quoted fields (default: doubled quotes)"`
+	Lazy      bool   `long:"lazy-quotes" description:"allow unescaped quotes within quoted fields"`
+	MultiLine bool   `long:"multiline" description:"quoted fields may contain newlines, so records may span multiple lines (requires --quote)"`
 	Header    bool   `long:"hdr" description:"Filename includes a header, which should be skipped (usually optional)"`
+	KeyFields int    `short:"k" long:"keys" description:"number of leading fields forming the key, for datasets sorted on multiple fields (default 1)"`
+	KeyColumn string `long:"keycol" description:"key column the dataset is sorted on, as a 0-based field number or header field name (default 0)"`
+	Secondary string `long:"secondary" description:"also write a secondary index on this column (0-based field number or header field name), for lookups on non-key columns"`
+	FixedKey  string `long:"fixed-key" description:"key position in fixed-width (undelimited) records, as byte OFFSET,LENGTH (e.g. 0,8)"`
+	RecLen    int    `long:"reclen" description:"fixed-width record length in bytes, for datasets without newlines (requires --fixed-key)"`
+	Widths    string `long:"widths" description:"fixed-width column widths in bytes, comma-separated (e.g. 8,20,5), for splitting values (requires --fixed-key)"`
+	WholeLine bool   `short:"w" long:"whole-line" description:"lines are keys, with no fields, as for word lists (default for .txt, .lst, and extensionless files without --sep)"`
+	Rev       bool   `short:"r" long:"rev" description:"Filename keys are reversed (e.g. reversed domain names), so searches should be too"`
 	Force     bool   `short:"f" long:"force" description:"force index generation even if up-to-date"`
 	Cat       bool   `short:"c" long:"cat" description:"write generated index to stdout instead of to file"`
 	Blocksize int    `short:"b" long:"bs" description:"index blocksize (kB, default 2kB)"`
@@ -38,6 +53,55 @@ func die(msg string) {
 	os.Exit(1)
 }
 
+// unescapeSep returns sep with any backslash escapes (e.g. `\t`, `\x1f`,
+// or `\u00fe`) interpreted, as for a Go string literal
+func unescapeSep(sep string) (string, error) {
+	if !strings.Contains(sep, `\`) {
+		return sep, nil
+	}
+	return strconv.Unquote(`"` + strings.ReplaceAll(sep, `"`, `\"`) + `"`)
+}
+
+// parseInts parses a comma-separated list of integers
+func parseInts(s string) ([]int, error) {
+	var ints []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+// writeSecondary writes a secondary index for column (a field number or
+// header field name) of filename, which must already be indexed
+func writeSecondary(filename, column string) {
+	col, err := strconv.Atoi(column)
+	if err != nil {
+		index, err := bsearch.LoadIndex(filename)
+		if err != nil {
+			die(err.Error())
+		}
+		col = -1
+		for n, name := range index.HeaderFields {
+			if name == column {
+				col = n
+				break
+			}
+		}
+		if col == -1 {
+			die(fmt.Sprintf("secondary column %q not found in header", column))
+		}
+	}
+
+	err = bsearch.WriteSecondaryIndex(filename, col)
+	if err != nil {
+		die(err.Error())
+	}
+}
+
 func main() {
 	// Parse default options are HelpFlag | PrintErrors | PassDoubleDash
 	parser := flags.NewParser(&opts, flags.Default)
@@ -79,21 +143,85 @@ func main() {
 			opts.Args.Filename)
 		os.Exit(2)
 	}
+	if opts.Secondary != "" && opts.Cat {
+		fmt.Fprintln(os.Stderr, "--secondary cannot be used with --cat")
+		os.Exit(2)
+	}
+	if opts.MultiLine && opts.Quote == "" {
+		fmt.Fprintln(os.Stderr, "--multiline requires --quote")
+		os.Exit(2)
+	}
+	if (opts.RecLen > 0 || opts.Widths != "") && opts.FixedKey == "" {
+		fmt.Fprintln(os.Stderr, "--reclen and --widths require --fixed-key")
+		os.Exit(2)
+	}
 
 	// Noop if a valid index already exists (unless --force is specified)
 	if !opts.Force && !opts.Cat {
 		_, err = bsearch.LoadIndex(opts.Args.Filename)
 		if err == nil {
 			log.Info().Msg("index file found and up to date")
+			if opts.Secondary != "" {
+				writeSecondary(opts.Args.Filename, opts.Secondary)
+			}
 			os.Exit(0)
 		}
 	}
 
 	// Generate and write index
-	idxopt := bsearch.IndexOptions{Delimiter: []byte(opts.Delim)}
+	delim, err := unescapeSep(opts.Delim)
+	if err != nil {
+		die(fmt.Sprintf("bad --sep %q: %s", opts.Delim, err))
+	}
+	idxopt := bsearch.IndexOptions{Delimiter: []byte(delim), WholeLine: opts.WholeLine}
 	if opts.Header {
 		idxopt.Header = true
 	}
+	if opts.Quote != "" {
+		idxopt.Dialect = &bsearch.Dialect{
+			Quote:      opts.Quote,
+			Escape:     opts.Escape,
+			LazyQuotes: opts.Lazy,
+			MultiLine:  opts.MultiLine,
+		}
+	}
+	if opts.FixedKey != "" {
+		key, err := parseInts(opts.FixedKey)
+		if err != nil || len(key) != 2 {
+			die(fmt.Sprintf("bad --fixed-key %q - expected OFFSET,LENGTH", opts.FixedKey))
+		}
+		idxopt.FixedWidth = &bsearch.FixedWidth{
+			KeyOffset:    key[0],
+			KeyLength:    key[1],
+			RecordLength: opts.RecLen,
+		}
+		if opts.Widths != "" {
+			idxopt.FixedWidth.Columns, err = parseInts(opts.Widths)
+			if err != nil {
+				die(fmt.Sprintf("bad --widths %q: %s", opts.Widths, err))
+			}
+		}
+	}
+	if opts.KeyFields > 1 {
+		idxopt.KeyFields = opts.KeyFields
+	}
+	if opts.KeyColumn != "" {
+		col, err := strconv.Atoi(opts.KeyColumn)
+		if err == nil {
+			idxopt.KeyColumn = col
+		} else {
+			idxopt.KeyColumnName = opts.KeyColumn
+		}
+	}
+	if opts.Compare != "" {
+		idxopt.Comparator, err = bsearch.LookupComparator(opts.Compare)
+		if err != nil {
+			die(fmt.Sprintf("%s %q", err.Error(), opts.Compare))
+		}
+	}
+	if opts.Rev {
+		idxopt.KeysReversed = true
+	}
 	if len(opts.Verbose) > 0 {
 		idxopt.Logger = &log.Logger
 	}
@@ -120,4 +248,8 @@ func main() {
 	if err != nil {
 		die(err.Error())
 	}
+
+	if opts.Secondary != "" {
+		writeSecondary(opts.Args.Filename, opts.Secondary)
+	}
 }
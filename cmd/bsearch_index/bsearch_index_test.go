@@ -27,7 +27,7 @@ func TestIndexFoo(t *testing.T) {
 	assert.Equal(t, true, index.KeysIndexFirst)
 	assert.Equal(t, false, index.KeysUnique)
 	assert.Equal(t, 2, len(index.List))
-	assert.Equal(t, 4, index.Version)
+	assert.Equal(t, 6, index.Version)
 
 	fh, err := os.Open("testdata/foo.csv")
 	if err != nil {
@@ -110,7 +110,7 @@ func TestIndexRIR(t *testing.T) {
 	assert.Equal(t, true, index.KeysIndexFirst)
 	assert.Equal(t, true, index.KeysUnique)
 	assert.Equal(t, 3178, index.Length)
-	assert.Equal(t, 4, index.Version)
+	assert.Equal(t, 6, index.Version)
 
 	fh, err := os.Open("testdata/rir_clc_ipv_range.csv")
 	if err != nil {
@@ -179,7 +179,7 @@ func TestIndexRIRHeader(t *testing.T) {
 	assert.Equal(t, true, index.KeysIndexFirst)
 	assert.Equal(t, true, index.KeysUnique)
 	assert.Equal(t, 3178, index.Length)
-	assert.Equal(t, 4, index.Version)
+	assert.Equal(t, 6, index.Version)
 
 	fh, err := os.Open("testdata/rir_clc_ipv_range.csv")
 	if err != nil {
@@ -0,0 +1,88 @@
+/*
+bsearch_sample outputs a uniformly random sample of the data records of a
+bsearch dataset (skipping any header), in dataset order e.g. for generating
+random test keys for bsearch_selftest.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/ProfoundNetworks/bsearch"
+	flags "github.com/jessevdk/go-flags"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Options
+var opts struct {
+	Verbose []bool `short:"v" long:"verbose" description:"display verbose debug output"`
+	Header  bool   `short:"H" long:"hdr" description:"Filename includes a header, which should be skipped (usually optional)"`
+	Number  int    `short:"n" long:"num" description:"number of records to output" default:"1000"`
+	Seed    int64  `short:"s" long:"seed" description:"random seed, for repeatable samples (default: current time)"`
+	Args    struct {
+		Filename string
+	} `positional-args:"yes" required:"yes"`
+}
+
+func die(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(1)
+}
+
+func main() {
+	// Parse default options are HelpFlag | PrintErrors | PassDoubleDash
+	parser := flags.NewParser(&opts, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		if flags.WroteHelp(err) {
+			os.Exit(0)
+		}
+
+		// Does PrintErrors work? Is it not set?
+		fmt.Fprintln(os.Stderr, "")
+		parser.WriteHelp(os.Stderr)
+		os.Exit(2)
+	}
+
+	// Setup
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	switch len(opts.Verbose) {
+	case 0:
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	case 1:
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	case 2:
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	default:
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	}
+
+	o := bsearch.SearcherOptions{Header: opts.Header}
+	if len(opts.Verbose) > 0 {
+		o.Logger = &log.Logger
+	}
+	bss, err := bsearch.NewSearcherOptions(opts.Args.Filename, o)
+	if err != nil {
+		die(err.Error())
+	}
+	defer bss.Close()
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Info().Int64("seed", seed).Msg("sampling")
+
+	lines, err := bss.Sample(opts.Number, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		die(err.Error())
+	}
+	for _, line := range lines {
+		fmt.Println(string(line))
+	}
+}
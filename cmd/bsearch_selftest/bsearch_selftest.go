@@ -8,7 +8,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/ProfoundNetworks/bsearch"
@@ -20,7 +20,7 @@ import (
 // Options
 var opts struct {
 	Verbose []bool `short:"v" long:"verbose" description:"display verbose debug output"`
-	Sep     string `short:"t" long:"sep" description:"separator"`
+	Sep     string `short:"t" long:"sep" unquote:"false" description:"separator, which must match the index delimiter (backslash escapes like \\x1f are interpreted)"`
 	Header  bool   `short:"H" long:"hdr" description:"CSV file includes a header (don't test)"`
 	Stdin   bool   `short:"i" long:"stdin" description:"read test data from stdin instead of from CSVFile"`
 	Args    struct {
@@ -33,22 +33,13 @@ func die(msg string) {
 	os.Exit(1)
 }
 
-func defaultSep() {
-	if opts.Sep != "" {
-		return
-	}
-	reSuffix := regexp.MustCompile(`\.([cpt]sv)$`)
-	matches := reSuffix.FindStringSubmatch(opts.Args.CSVFile)
-	if matches != nil {
-		switch matches[1] {
-		case "psv":
-			opts.Sep = "|"
-		case "tsv":
-			opts.Sep = "\t"
-		default:
-			opts.Sep = ","
-		}
+// unescapeSep returns sep with any backslash escapes (e.g. `\t`, `\x1f`,
+// or `\u00fe`) interpreted, as for a Go string literal
+func unescapeSep(sep string) (string, error) {
+	if !strings.Contains(sep, `\`) {
+		return sep, nil
 	}
+	return strconv.Unquote(`"` + strings.ReplaceAll(sep, `"`, `\"`) + `"`)
 }
 
 func tap(rownum int, status, key, diag string) {
@@ -138,17 +129,34 @@ func main() {
 			die(err.Error())
 		}
 	}
-	defaultSep()
-	log.Info().
-		Str("sep", opts.Sep).
-		Msg("")
 	bss, err := bsearch.NewSearcher(opts.Args.CSVFile)
 	if err != nil {
 		die(err.Error())
 	}
 	defer bss.Close()
+	if opts.Sep == "" {
+		opts.Sep = string(bss.Index.Delimiter)
+	} else {
+		sep, err := unescapeSep(opts.Sep)
+		if err != nil {
+			die(fmt.Sprintf("bad --sep %q: %s", opts.Sep, err))
+		}
+		if sep != string(bss.Index.Delimiter) {
+			die(fmt.Sprintf("--sep %q does not match the index delimiter %q",
+				sep, bss.Index.Delimiter))
+		}
+		opts.Sep = sep
+	}
+	log.Info().
+		Str("sep", opts.Sep).
+		Msg("")
 	keysUnique := bss.Index.KeysUnique
 	scanner := bufio.NewScanner(fh)
+	if bss.Index.Dialect != nil || bss.Index.FixedWidth != nil {
+		// Quoted datasets may have multi-line records, and fixed-width
+		// ones may have fixed-length records without newlines
+		scanner.Split(bss.Index.ScanRecords)
+	}
 
 	// Process
 	rownum := 1
@@ -162,15 +170,9 @@ func main() {
 			continue
 		}
 
-		// NB: this split *requires* that there are no escaped delimiters
-		// in the key. But that should always be the case on these kinds
-		// of datasets, since `sort(1)` won't sort them correctly otherwise.
-		splits := strings.SplitN(line, opts.Sep, 2)
-		if len(splits) != 2 {
-			die(fmt.Sprintf("Cannot split key+value on %q in line %d: %s\n",
-				opts.Sep, rownum, line))
-		}
-		key := splits[0]
+		// Let the index extract keys, since they may be in any column,
+		// span several fields, be quoted, or be padded
+		key := string(bss.Index.Key([]byte(line)))
 
 		// keysUnique processing - individual lines
 		if keysUnique {
@@ -180,11 +182,15 @@ func main() {
 		}
 
 		// Duplicate keys processing - accumulate batch with the same key
-		if key < prevKey {
+		cmp := 1
+		if len(batch) > 0 {
+			cmp = bss.Index.Compare([]byte(key), []byte(prevKey))
+		}
+		if cmp < 0 {
 			// Keys must be in sorted order for dup keys processing
 			die(fmt.Sprintf("Unsorted input? Line %d key %q < %q",
 				rownum, key, prevKey))
-		} else if key == prevKey {
+		} else if cmp == 0 {
 			batch = append(batch, line)
 		} else {
 			// Break - process batch and reset
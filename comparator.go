@@ -0,0 +1,268 @@
+package bsearch
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+const collatePrefix = "collate:"
+
+var (
+	ErrUnknownComparator = errors.New("unknown comparator")
+)
+
+// Comparator defines the key ordering of a dataset. Compare returns an
+// integer comparing keys a and b, which is 0 if a == b, -1 if a < b, and
+// +1 if a > b (like bytes.Compare). Name identifies the Comparator in
+// index files, so must be unique (see RegisterComparator).
+//
+// Prefix-based lookups (PrefixLines, Glob, Regexp, LongestPrefix) assume
+// keys sharing a prefix sort together, which holds for Bytewise and
+// CaseFold, but not in general for collation orders.
+type Comparator interface {
+	Name() string
+	Compare(a, b []byte) int
+}
+
+// Bytewise orders keys by their raw bytes (like `LC_ALL=C sort`), and is
+// the default Comparator.
+var Bytewise Comparator = bytewise{}
+
+// CaseFold orders keys by their upper-cased UTF-8 runes (like
+// `LC_ALL=C sort -f`), so keys differing only in case are equal.
+var CaseFold Comparator = caseFold{}
+
+// Numeric orders keys by their leading decimal number (like
+// `LC_ALL=C sort -n`): an optional '-' sign, digits, and an optional
+// decimal point and fraction, after any leading blanks. Numbers may be
+// arbitrarily long, and keys without a leading number compare as zero.
+// For composite keys, only the leading number is compared.
+var Numeric Comparator = numeric{}
+
+// General orders keys by their leading floating point number (like
+// `LC_ALL=C sort -g`), including exponents (e.g. "1.5e3") and infinities,
+// with keys that are not valid numbers sorting first, followed by NaNs.
+// For composite keys, only the leading number is compared.
+var General Comparator = general{}
+
+var comparators = struct {
+	sync.RWMutex
+	m map[string]Comparator
+}{m: map[string]Comparator{
+	Bytewise.Name(): Bytewise,
+	CaseFold.Name(): CaseFold,
+	Numeric.Name():  Numeric,
+	General.Name():  General,
+}}
+
+// RegisterComparator registers c, so that indexes using it can be loaded
+// (by name). Registering a Comparator with the same name as an existing
+// one replaces it.
+func RegisterComparator(c Comparator) {
+	comparators.Lock()
+	defer comparators.Unlock()
+	comparators.m[c.Name()] = c
+}
+
+// LookupComparator returns the registered Comparator called name, or a
+// collation Comparator if name is of the form "collate:TAG" (see
+// Collation). Returns ErrUnknownComparator if there is no such Comparator.
+func LookupComparator(name string) (Comparator, error) {
+	comparators.RLock()
+	c, ok := comparators.m[name]
+	comparators.RUnlock()
+	if ok {
+		return c, nil
+	}
+	if strings.HasPrefix(name, collatePrefix) {
+		return Collation(strings.TrimPrefix(name, collatePrefix))
+	}
+	return nil, ErrUnknownComparator
+}
+
+// Collation returns a Comparator ordering keys using the Unicode Collation
+// Algorithm, tailored for the BCP 47 language tag (e.g. "en", or "de").
+// Tag extensions may be used to set collation options e.g.
+// "en-u-ka-shifted" ignores punctuation and spaces at the primary level,
+// which is closer to the glibc locale order used by `sort`.
+// Returns ErrUnknownComparator if tag is invalid.
+func Collation(tag string) (Comparator, error) {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return nil, ErrUnknownComparator
+	}
+	return &collation{
+		name:     collatePrefix + tag,
+		collator: collate.New(t, collate.OptionsFromTag(t)),
+	}, nil
+}
+
+type bytewise struct{}
+
+func (bytewise) Name() string { return "bytes" }
+
+func (bytewise) Compare(a, b []byte) int { return bytes.Compare(a, b) }
+
+type caseFold struct{}
+
+func (caseFold) Name() string { return "casefold" }
+
+func (caseFold) Compare(a, b []byte) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRune(a)
+		rb, nb := utf8.DecodeRune(b)
+		ra, rb = unicode.ToUpper(ra), unicode.ToUpper(rb)
+		if ra != rb {
+			if ra < rb {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[na:], b[nb:]
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+type numeric struct{}
+
+func (numeric) Name() string { return "numeric" }
+
+func (numeric) Compare(a, b []byte) int {
+	nega, inta, fraca := parseNumeric(a)
+	negb, intb, fracb := parseNumeric(b)
+	if nega != negb {
+		if nega {
+			return -1
+		}
+		return 1
+	}
+
+	// Compare magnitudes: longer integer parts are larger, and otherwise
+	// integer and then fraction digits compare bytewise
+	cmp := 0
+	switch {
+	case len(inta) < len(intb):
+		cmp = -1
+	case len(inta) > len(intb):
+		cmp = 1
+	default:
+		cmp = bytes.Compare(inta, intb)
+		if cmp == 0 {
+			cmp = bytes.Compare(fraca, fracb)
+		}
+	}
+	if nega {
+		return -cmp
+	}
+	return cmp
+}
+
+// parseNumeric parses the leading decimal number in b, returning its sign
+// (false for zero), and its integer and fraction digits, stripped of
+// leading and trailing zeroes respectively.
+func parseNumeric(b []byte) (neg bool, intDigits, fracDigits []byte) {
+	b = bytes.TrimLeft(b, " \t")
+	if len(b) > 0 && b[0] == '-' {
+		neg = true
+		b = b[1:]
+	}
+	n := 0
+	for n < len(b) && b[n] >= '0' && b[n] <= '9' {
+		n++
+	}
+	intDigits = bytes.TrimLeft(b[:n], "0")
+	if n < len(b) && b[n] == '.' {
+		b = b[n+1:]
+		n = 0
+		for n < len(b) && b[n] >= '0' && b[n] <= '9' {
+			n++
+		}
+		fracDigits = bytes.TrimRight(b[:n], "0")
+	}
+	if len(intDigits) == 0 && len(fracDigits) == 0 {
+		neg = false
+	}
+	return neg, intDigits, fracDigits
+}
+
+type general struct{}
+
+func (general) Name() string { return "general" }
+
+func (general) Compare(a, b []byte) int {
+	fa, oka := parseGeneral(a)
+	fb, okb := parseGeneral(b)
+	switch {
+	case !oka || !okb:
+		return compareBool(oka, okb)
+	case math.IsNaN(fa) || math.IsNaN(fb):
+		return compareBool(!math.IsNaN(fa), !math.IsNaN(fb))
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+// parseGeneral parses the leading floating point number in b (after any
+// blanks), returning false if b does not begin with a valid number.
+func parseGeneral(b []byte) (float64, bool) {
+	b = bytes.TrimLeft(b, " \t")
+	n := 0
+	for n < len(b) && (b[n] >= '0' && b[n] <= '9' || b[n] >= 'a' && b[n] <= 'z' ||
+		b[n] >= 'A' && b[n] <= 'Z' || b[n] == '.' || b[n] == '-' || b[n] == '+') {
+		n++
+	}
+	// Like strtod, use the longest prefix of the token that is a valid
+	// number (e.g. "10kg" is 10)
+	for ; n > 0; n-- {
+		f, err := strconv.ParseFloat(string(b[:n]), 64)
+		if err == nil || errors.Is(err, strconv.ErrRange) {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// compareBool compares a and b, with false sorting before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+// collation is a Comparator using a collate.Collator, which is not safe
+// for concurrent use, so calls are serialised.
+type collation struct {
+	name     string
+	mu       sync.Mutex
+	collator *collate.Collator
+}
+
+func (c *collation) Name() string { return c.name }
+
+func (c *collation) Compare(a, b []byte) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collator.Compare(a, b)
+}
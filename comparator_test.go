@@ -0,0 +1,313 @@
+package bsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparators(t *testing.T) {
+	en, err := Collation("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		cmp    Comparator
+		a      string
+		b      string
+		expect int
+	}{
+		{Bytewise, "abc", "abd", -1},
+		{Bytewise, "abc", "ABC", 1},
+		{Bytewise, "Zulu", "_under", -1},
+		{CaseFold, "abc", "ABC", 0},
+		{CaseFold, "abc", "ABD", -1},
+		{CaseFold, "Zulu", "_under", -1},
+		{CaseFold, "zulu", "_under", -1},
+		{CaseFold, "straße", "STRASSE", 1},
+		{CaseFold, "éclair", "ÉCLAIR", 0},
+		{CaseFold, "ab", "abc", -1},
+		{Numeric, "2", "10", -1},
+		{Numeric, "10", "10.00", 0},
+		{Numeric, "-3", "-12.5", 1},
+		{Numeric, "-0.0", "0", 0},
+		{Numeric, " 007", "7,foo", 0},
+		{Numeric, "abc", "0", 0},
+		{Numeric, ".5", "0.45", 1},
+		{Numeric, "99999999999999999999", "100000000000000000000", -1},
+		{General, "1e3", "999", 1},
+		{General, "-inf", "-1e308", -1},
+		{General, "x", "nan", -1},
+		{General, "nan", "-inf", -1},
+		{General, "NaN", "nan", 0},
+		{General, "1.5e2,x", "150", 0},
+		{General, "10kg", "9", 1},
+		{General, "10kg", "10", 0},
+		{General, "1e3e3", "1000", 0},
+		{en, "Äpfel", "apple", -1},
+		{en, "café", "cafe", 1},
+		{en, "éclair", "eclairs", -1},
+		{en, "Zebra", "apple", 1},
+	}
+
+	for _, tc := range tests {
+		got := tc.cmp.Compare([]byte(tc.a), []byte(tc.b))
+		assert.Equal(t, tc.expect, got, tc.cmp.Name()+": "+tc.a+" vs "+tc.b)
+	}
+}
+
+func TestLookupComparator(t *testing.T) {
+	for _, name := range []string{"bytes", "casefold", "numeric", "general",
+		"collate:en", "collate:de-u-ka-shifted"} {
+		c, err := LookupComparator(name)
+		assert.Nil(t, err, name)
+		if err == nil {
+			assert.Equal(t, name, c.Name())
+		}
+	}
+
+	_, err := LookupComparator("foobar")
+	assert.Equal(t, ErrUnknownComparator, err)
+	_, err = LookupComparator("collate:!!")
+	assert.Equal(t, ErrUnknownComparator, err)
+}
+
+// Test Searcher lookups on testdata/casefold.csv (sorted with `sort -f`)
+func TestSearcherCaseFold(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"alstom.com", []string{"alstom.com,2", "ALSTOM.COM,3"}},
+		{"Alstom.Com", []string{"alstom.com,2", "ALSTOM.COM,3"}},
+		{"BETA", []string{"Beta,4", "beta,5"}},
+		{"_under", []string{"_under,7"}},
+		{"alp", nil},
+		{"gamma", nil},
+	}
+
+	_, err := NewIndexOptions("testdata/casefold.csv", IndexOptions{})
+	assert.NotNil(t, err, "bytewise sort violation")
+
+	writeIndexOptions(t, "casefold.csv", IndexOptions{Comparator: CaseFold})
+	s, err := NewSearcher("testdata/casefold.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, "casefold", s.Index.Comparator)
+	assert.Equal(t, false, s.Index.KeysUnique)
+
+	for _, tc := range tests {
+		lines, err := s.Lines([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+			continue
+		}
+		assert.Nil(t, err, tc.key)
+		got := []string{}
+		for _, l := range lines {
+			got = append(got, string(l))
+		}
+		assert.Equal(t, tc.expect, got, tc.key)
+
+		count, err := s.Count([]byte(tc.key))
+		assert.Nil(t, err)
+		assert.Equal(t, len(tc.expect), count, tc.key+" count")
+	}
+
+	lines, err := s.PrefixLines([]byte("AL"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(lines), "PrefixLines AL")
+
+	line, err := s.Floor([]byte("yankee"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Beta,4", string(line), "Floor yankee")
+
+	for _, tc := range []struct{ query, expect string }{
+		{"alstom.company", "alstom.com,2"},
+		{"ALSTOM.COMPANY", "alstom.com,2"},
+		{"beta.max", "Beta,4"},
+		{"alpine", ""},
+	} {
+		line, err := s.LongestPrefix([]byte(tc.query))
+		if tc.expect == "" {
+			assert.Equal(t, ErrNotFound, err, "LongestPrefix "+tc.query)
+			continue
+		}
+		assert.Nil(t, err, "LongestPrefix "+tc.query)
+		assert.Equal(t, tc.expect, string(line), "LongestPrefix "+tc.query)
+	}
+
+	db, err := NewDB("testdata/casefold.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	val, err := db.GetString("ALSTOM.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", val)
+}
+
+// Test Searcher lookups on testdata/collation_en.csv (sorted using
+// Unicode collation for English)
+func TestSearcherCollation(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"Äpfel", "Äpfel,1"},
+		{"cafe", "cafe,5"},
+		{"café", "café,6"},
+		{"éclair", "éclair,7"},
+		{"Ökonom", "Ökonom,9"},
+		{"zoo", "zoo,14"},
+		{"apfel", ""},
+		{"dog", ""},
+	}
+
+	_, err := NewIndexOptions("testdata/collation_en.csv", IndexOptions{})
+	assert.NotNil(t, err, "bytewise sort violation")
+
+	en, err := Collation("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeIndexOptions(t, "collation_en.csv", IndexOptions{Comparator: en, Blocksize: 32})
+	s, err := NewSearcher("testdata/collation_en.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, "collate:en", s.Index.Comparator)
+
+	for _, tc := range tests {
+		line, err := s.Line([]byte(tc.key))
+		if tc.expect == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+			continue
+		}
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, tc.expect, string(line), tc.key)
+	}
+
+	line, err := s.Ceiling([]byte("dog"))
+	assert.Nil(t, err)
+	assert.Equal(t, "éclair,7", string(line), "Ceiling dog")
+
+	count, err := s.CountRange([]byte("b"), []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count, "CountRange b-d")
+}
+
+// Test Searcher lookups on testdata/numeric.csv (sorted with `sort -n`)
+func TestSearcherNumeric(t *testing.T) {
+	var tests = []struct {
+		key     string
+		expect  []string
+		floor   string
+		ceiling string
+	}{
+		{"10", []string{"10,ten", "10.0,ten-point-oh"}, "10,ten", "10,ten"},
+		{"10.000", []string{"10,ten", "10.0,ten-point-oh"}, "10,ten", "10,ten"},
+		{"-3", []string{"-3,neg"}, "-3,neg", "-3,neg"},
+		{"0", []string{"-0.0,negzero", "0,zero"}, "-0.0,negzero", "-0.0,negzero"},
+		{"1000000000000000000000001", []string{"1000000000000000000000001,big"},
+			"1000000000000000000000001,big", "1000000000000000000000001,big"},
+		{"50", nil, "10,ten", "99,ninety-nine"},
+		{"-1", nil, "-3,neg", "-0.0,negzero"},
+		{"-20", nil, "", "-12.5,neg"},
+		{"5000000000000000000000000", nil, "1000000000000000000000001,big", ""},
+		{"1e30", nil, "0.5,half", "2,two"}, // no exponents with sort -n
+	}
+
+	_, err := NewIndexOptions("testdata/numeric.csv", IndexOptions{})
+	assert.NotNil(t, err, "bytewise sort violation")
+
+	writeIndexOptions(t, "numeric.csv", IndexOptions{Comparator: Numeric})
+	s, err := NewSearcher("testdata/numeric.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, "numeric", s.Index.Comparator)
+
+	for _, tc := range tests {
+		lines, err := s.Lines([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+		} else {
+			assert.Nil(t, err, tc.key)
+			got := []string{}
+			for _, l := range lines {
+				got = append(got, string(l))
+			}
+			assert.Equal(t, tc.expect, got, tc.key)
+		}
+
+		line, err := s.Floor([]byte(tc.key))
+		if tc.floor == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key+" floor")
+		} else {
+			assert.Nil(t, err, tc.key+" floor")
+			assert.Equal(t, tc.floor, string(line), tc.key+" floor")
+		}
+
+		line, err = s.Ceiling([]byte(tc.key))
+		if tc.ceiling == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key+" ceiling")
+		} else {
+			assert.Nil(t, err, tc.key+" ceiling")
+			assert.Equal(t, tc.ceiling, string(line), tc.key+" ceiling")
+		}
+	}
+
+	count, err := s.CountRange([]byte("0"), []byte("100"))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, count, "CountRange 0-100")
+
+	// Numeric isn't prefix-compatible, but LongestPrefix must terminate
+	line, err := s.LongestPrefix([]byte("99.5"))
+	assert.Nil(t, err, "LongestPrefix 99.5")
+	assert.Equal(t, "99,ninety-nine", string(line), "LongestPrefix 99.5")
+	_, err = s.LongestPrefix([]byte("5"))
+	assert.Equal(t, ErrNotFound, err, "LongestPrefix 5")
+}
+
+// Test Searcher lookups on testdata/general.csv (sorted with `sort -g`)
+func TestSearcherGeneral(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"-1000.0", "-1e3,a"},
+		{"-1000", "-1e3,a"},
+		{"0.001", "1e-3,c"},
+		{"150", "1.5e2,e"},
+		{"+Inf", "inf,posinf"},
+		{"NaN", "nan,nan"},
+		{"y", "x,nan-text"},
+		{"2", ""},
+	}
+
+	writeIndexOptions(t, "general.csv", IndexOptions{Comparator: General})
+	s, err := NewSearcher("testdata/general.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		line, err := s.Line([]byte(tc.key))
+		if tc.expect == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+			continue
+		}
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, tc.expect, string(line), tc.key)
+	}
+
+	_, err = s.LongestPrefix([]byte("2"))
+	assert.Equal(t, ErrNotFound, err, "LongestPrefix 2")
+}
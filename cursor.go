@@ -0,0 +1,103 @@
+/*
+Cursor provides bidirectional line-by-line navigation over the dataset
+of a bsearch.Searcher.
+*/
+
+package bsearch
+
+// Cursor is a position within a Searcher's dataset that can be moved
+// forwards and backwards a line at a time. A Cursor may also be positioned
+// before the first line or after the last one (e.g. by a Seek past the end
+// of the data), in which case it is not Valid, but Next and Prev still move
+// it onto the first and last lines respectively.
+type Cursor struct {
+	s      *Searcher
+	offset int64  // offset of the current line (-1 if before the first line)
+	next   int64  // offset of the line following the current one
+	line   []byte // current line
+	key    []byte // current key
+}
+
+// Cursor returns a new Cursor for s, initially positioned before the
+// first line.
+func (s *Searcher) Cursor() (*Cursor, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{s: s, offset: -1}, nil
+}
+
+// setOffset positions c at the line beginning at offset, returning
+// true if c is then Valid.
+func (c *Cursor) setOffset(offset int64) bool {
+	c.offset = offset
+	if offset < 0 || offset >= c.s.l {
+		c.next = offset
+		c.line, c.key = nil, nil
+		return false
+	}
+	c.line, c.next = c.s.lineAt(offset)
+	c.key = c.s.Index.lineKey(c.line)
+	return true
+}
+
+// Seek positions c at the first line with a key greater-than-or-equal-to
+// key, using a binary search (data must be ordered by the index Comparator).
+// Returns false if no such line exists, in which case c is positioned after
+// the last line.
+func (c *Cursor) Seek(key []byte) bool {
+	return c.setOffset(c.s.seekOffset(c.s.searchKey(key), false))
+}
+
+// First positions c at the first line of the dataset (skipping any header),
+// returning false if the dataset is empty.
+func (c *Cursor) First() bool {
+	return c.setOffset(c.s.dataOffset())
+}
+
+// Last positions c at the last line of the dataset, returning false if the
+// dataset is empty.
+func (c *Cursor) Last() bool {
+	return c.setOffset(c.s.prevLineOffset(c.s.l))
+}
+
+// Next moves c to the following line, returning false if c was already
+// on the last line (c is then positioned after the last line).
+func (c *Cursor) Next() bool {
+	if c.offset < 0 {
+		return c.First()
+	}
+	if c.offset >= c.s.l {
+		return false
+	}
+	return c.setOffset(c.next)
+}
+
+// Prev moves c to the preceding line, returning false if c was already
+// on the first line (c is then positioned before the first line).
+func (c *Cursor) Prev() bool {
+	if c.offset < 0 {
+		return false
+	}
+	return c.setOffset(c.s.prevLineOffset(c.offset))
+}
+
+// Valid returns true if c is currently positioned on a line.
+func (c *Cursor) Valid() bool {
+	return c.line != nil
+}
+
+// Line returns the current line (or nil if c is not Valid). The returned
+// slice points directly into the Searcher's data, so it must not be
+// modified, is only valid until the Searcher is closed, and is never
+// reversed.
+func (c *Cursor) Line() []byte {
+	return c.line
+}
+
+// Key returns the key of the current line (subject to the same caveats
+// as Line).
+func (c *Cursor) Key() []byte {
+	return c.key
+}
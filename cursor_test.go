@@ -0,0 +1,97 @@
+package bsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Cursor using testdata/alstom2.csv (header, no trailing newline)
+func TestCursor(t *testing.T) {
+	ensureIndex(t, "alstom2.csv")
+	s, err := NewSearcher("testdata/alstom2.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c, err := s.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, c.Valid(), "new cursor is not valid")
+
+	// Walk forwards from before the first line
+	expect := []string{
+		"alstom.ca,alstom.com,RED",
+		"alstom.co.th,alstom.com,RED",
+		"alstom.com,alstom.com,SOA",
+		"alstom.com,alstom.com,ULT",
+		"alstom.com.au,alstom.com,RED",
+		"alstom.com.br,alstom.com,RED",
+	}
+	got := []string{}
+	for c.Next() {
+		got = append(got, string(c.Line()))
+	}
+	assert.Equal(t, expect, got, "forward iteration")
+	assert.False(t, c.Valid(), "cursor invalid after last line")
+
+	// Walk backwards from after the last line
+	got = []string{}
+	for c.Prev() {
+		got = append([]string{string(c.Line())}, got...)
+	}
+	assert.Equal(t, expect, got, "backward iteration")
+	assert.False(t, c.Valid(), "cursor invalid before first line")
+
+	// First and Last
+	assert.True(t, c.Last())
+	assert.Equal(t, "alstom.com.br,alstom.com,RED", string(c.Line()))
+	assert.Equal(t, "alstom.com.br", string(c.Key()))
+	assert.True(t, c.First())
+	assert.Equal(t, "alstom.ca,alstom.com,RED", string(c.Line()))
+	assert.False(t, c.Prev(), "no line before first")
+}
+
+// Test Cursor.Seek() using testdata/alstom1.csv
+func TestCursorSeek(t *testing.T) {
+	var tests = []struct {
+		key  string
+		line string
+		prev string
+		next string
+	}{
+		{"alstom.com", "alstom.com,alstom.com,SOA", "alstom.co.th,alstom.com,RED", "alstom.com,alstom.com,ULT"},
+		{"alstom.com.a", "alstom.com.au,alstom.com,RED", "alstom.com,alstom.com,ULT", "alstom.com.br,alstom.com,RED"},
+		{"aaa", "alstom.ca,alstom.com,RED", "", "alstom.co.th,alstom.com,RED"},
+		{"alt.com", "alt.com,alt.com,SOA", "alstom.com.br,alstom.com,RED", ""},
+		{"zzz", "", "alt.com,alt.com,SOA", ""},
+	}
+
+	ensureIndex(t, "alstom1.csv")
+	s, err := NewSearcher("testdata/alstom1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c, err := s.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		ok := c.Seek([]byte(tc.key))
+		assert.Equal(t, tc.line != "", ok, tc.key+" seek")
+		assert.Equal(t, tc.line, string(c.Line()), tc.key+" line")
+
+		ok = c.Prev()
+		assert.Equal(t, tc.prev != "", ok, tc.key+" prev")
+		assert.Equal(t, tc.prev, string(c.Line()), tc.key+" prev line")
+
+		c.Seek([]byte(tc.key))
+		ok = c.Next()
+		assert.Equal(t, tc.next != "", ok, tc.key+" next")
+		assert.Equal(t, tc.next, string(c.Line()), tc.key+" next line")
+	}
+}
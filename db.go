@@ -7,7 +7,6 @@ package bsearch
 
 import (
 	"bytes"
-	"encoding/csv"
 	"fmt"
 	"io"
 )
@@ -22,7 +21,16 @@ type DB struct {
 // NewDB returns a new DB for the file at path. The caller is responsible
 // for calling DB.Close() when finished (e.g. via defer).
 func NewDB(path string) (*DB, error) {
-	bss, err := NewSearcher(path)
+	return NewDBOptions(path, SearcherOptions{})
+}
+
+// NewDBOptions returns a new DB for the file at path, using opt for the
+// underlying Searcher (e.g. to set IntervalEnd, for interval lookups on
+// range tables). opt.ReverseLines is ignored. The caller is responsible for
+// calling DB.Close() when finished (e.g. via defer).
+func NewDBOptions(path string, opt SearcherOptions) (*DB, error) {
+	opt.ReverseLines = false
+	bss, err := NewSearcherOptions(path, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -38,17 +46,29 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// Remove leading key+delimiter from line
-	prefix := append(key, db.bss.Index.Delimiter...)
-	// Sanity check
-	if !bytes.HasPrefix(line, prefix) {
-		panic(
-			fmt.Sprintf("line returned for %q does not begin with key+delim: %s\n",
-				key, line))
-	}
-	line = bytes.TrimPrefix(line, prefix)
+	return db.value(db.lineKey(key, line), line), nil
+}
 
-	return line, nil
+// GetFunc calls fn with the (first) value associated with key in db
+// (or returns ErrNotFound if missing), like Get. Unlike Get, GetFunc does
+// not copy the value (and except on KeysReversed datasets, whose search
+// keys must be reversed, does not allocate): val points directly into the
+// underlying Searcher's data, so it must not be modified, and is only
+// valid until db is closed.
+func (db *DB) GetFunc(key []byte, fn func(val []byte)) error {
+	if db.bss.matchLE && db.bss.intervalEnd == 0 {
+		offset, err := db.bss.floorOffset(db.bss.searchKey(key))
+		if err != nil {
+			return err
+		}
+		line, _ := db.bss.lineAt(offset)
+		fn(db.value(db.lineKey(key, line), line))
+		return nil
+	}
+	return db.bss.Each(key, func(line []byte) bool {
+		fn(db.value(db.lineKey(key, line), line))
+		return false
+	})
 }
 
 // GetString returns the (first) value associated with key in db, as a string
@@ -62,27 +82,71 @@ func (db *DB) GetString(key string) (string, error) {
 }
 
 // GetSlice returns the (first) value associated with key in db as a string
-// slice (read using a csv.Reader with the appropriate Delimiter)
-// (or returns ErrNotFound if missing)
+// slice (read using a csv.Reader with the appropriate Delimiter, or split
+// and unquoted according to the index Dialect, if set, or just split on
+// multi-rune delimiters, or for FixedWidth datasets, split by the layout
+// Columns widths) (or returns ErrNotFound if missing)
 func (db *DB) GetSlice(key string) ([]string, error) {
 	val, err := db.Get([]byte(key))
 	if err != nil {
 		return []string{}, err
 	}
-	delim := string(db.bss.Index.Delimiter)
-	if len(delim) > 1 {
-		return []string{},
-			fmt.Errorf("cannot convert multi-character delimiter %q to rune", delim)
+	if fw := db.bss.Index.FixedWidth; fw != nil {
+		return fw.fields(val, fw.valueStart()), nil
 	}
-	reader := csv.NewReader(bytes.NewReader(val))
-	reader.Comma = rune(delim[0])
-	s, err := reader.Read()
+	s, err := db.bss.Index.splitFields(val)
 	if err != nil {
 		return []string{}, err
 	}
 	return s, nil
 }
 
+// lineKey returns the key of line, as returned for a lookup on key. This
+// is usually just key (or its searchKey), but with MatchLE or IntervalEnd
+// lines are returned for keys other than key, and with a non-bytewise
+// Comparator, for keys equal to key (e.g. with CaseFold, "ABC" for "abc").
+func (db *DB) lineKey(key, line []byte) []byte {
+	if db.bss.matchLE || db.bss.intervalEnd > 0 {
+		return db.bss.Index.lineKey(line)
+	}
+	key = db.bss.searchKey(key)
+	if db.bss.Index.comparator != nil && !bytes.HasPrefix(line, key) {
+		// Composite key lookups may be on a leading subset of the fields
+		if db.bss.Index.KeyFields > 1 && len(line) >= len(key) {
+			return line[:len(key)]
+		}
+		return db.bss.Index.lineKey(line)
+	}
+	return key
+}
+
+// value returns line with the leading key+delimiter removed (or for
+// datasets with a KeyColumn other than the first, the whole line)
+func (db *DB) value(key, line []byte) []byte {
+	if db.bss.Index.KeyColumn > 0 {
+		return line
+	}
+	if fw := db.bss.Index.FixedWidth; fw != nil {
+		// Keys are padded, so trim by position
+		if start := fw.valueStart(); start < len(line) {
+			return line[start:]
+		}
+		return line[:0]
+	}
+	if db.bss.Index.Dialect != nil {
+		// Quoted keys differ from the key searched for, so trim by fields
+		return db.bss.Index.trimKey(line, len(key))
+	}
+	// Sanity check
+	if !bytes.HasPrefix(line, key) {
+		panic(
+			fmt.Sprintf("line returned for %q does not begin with key: %s\n",
+				key, line))
+	}
+	line = line[len(key):]
+	return bytes.TrimPrefix(line, db.bss.Index.Delimiter)
+}
+
 // Close closes our Searcher's underlying reader (if applicable)
 func (db *DB) Close() {
 	if closer, ok := db.bss.r.(io.Closer); ok {
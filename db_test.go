@@ -133,3 +133,217 @@ func TestDBGetSlice(t *testing.T) {
 			key, err, strings.Join(s, ","))
 	}
 }
+
+// Test DB.GetFunc() using testdata/rdns1.csv
+// (not parallel, since it uses testing.AllocsPerRun)
+func TestDBGetFunc(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"001.000.128.000", "node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net"},
+		{"032.176.184.000", "mobile000.mycingular.net,202003,mycingular.net"},
+		{"223.252.003.000", "223-252-3-0.as45671.net,202003,as45671.net"},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	db, err := NewDB("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var got []byte
+	fn := func(val []byte) {
+		got = val
+	}
+	for _, tc := range tests {
+		got = nil
+		err := db.GetFunc([]byte(tc.key), fn)
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.key, err.Error())
+		}
+		if string(got) != tc.expect {
+			t.Errorf("%q => %q\n   expected %q\n", tc.key, got, tc.expect)
+		}
+
+		// GetFunc should not allocate
+		key := []byte(tc.key)
+		allocs := testing.AllocsPerRun(100, func() {
+			db.GetFunc(key, fn)
+		})
+		if allocs > 0 {
+			t.Errorf("%q: GetFunc allocated %v times, expected 0", tc.key, allocs)
+		}
+	}
+
+	// Lookup a missing key
+	key := "foobar"
+	got = nil
+	err = db.GetFunc([]byte(key), fn)
+	if err == nil || err != ErrNotFound || got != nil {
+		t.Errorf("%q => %q, %q\n   expected ErrNotFound\n", key, err, got)
+	}
+}
+
+// Test DB.GetFunc() with MatchLE using testdata/foo.csv
+// (not parallel, since it uses testing.AllocsPerRun)
+func TestDBGetFuncMatchLE(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"bar", "1"},
+		{"baz", "1"},
+		{"foo", "2"},
+		{"zzz", "2"},
+	}
+
+	ensureIndex(t, "foo.csv")
+	db, err := NewDBOptions("testdata/foo.csv", SearcherOptions{MatchLE: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var got []byte
+	fn := func(val []byte) {
+		got = val
+	}
+	for _, tc := range tests {
+		got = nil
+		err := db.GetFunc([]byte(tc.key), fn)
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.key, err.Error())
+		}
+		if string(got) != tc.expect {
+			t.Errorf("%q => %q\n   expected %q\n", tc.key, got, tc.expect)
+		}
+
+		key := []byte(tc.key)
+		allocs := testing.AllocsPerRun(100, func() {
+			db.GetFunc(key, fn)
+		})
+		if allocs > 0 {
+			t.Errorf("%q: GetFunc allocated %v times, expected 0", tc.key, allocs)
+		}
+	}
+
+	key := "a"
+	got = nil
+	err = db.GetFunc([]byte(key), fn)
+	if err != ErrNotFound || got != nil {
+		t.Errorf("%q => %q, %q\n   expected ErrNotFound\n", key, err, got)
+	}
+}
+
+// Test DB.Get() in interval mode using testdata/ipv4_ranges.csv
+func TestDBGetInterval(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"001.000.000.128", "001.000.000.255,AU"},
+		{"001.000.010.000", "001.000.015.255,CN"},
+		{"002.016.200.000", "002.016.255.255,EU"},
+		{"001.000.005.000", ""},
+	}
+
+	ensureIndex(t, "ipv4_ranges.csv")
+	db, err := NewDBOptions("testdata/ipv4_ranges.csv", SearcherOptions{IntervalEnd: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tc := range tests {
+		got, err := db.GetString(tc.key)
+		if tc.expect == "" {
+			if err != ErrNotFound {
+				t.Errorf("%q => %q, %v\n   expected ErrNotFound\n", tc.key, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.key, err.Error())
+		}
+		if got != tc.expect {
+			t.Errorf("%q => %q\n   expected %q\n", tc.key, got, tc.expect)
+		}
+	}
+}
+
+// Test DB.Get() with composite keys using testdata/composite.csv
+func TestDBGetKeyFields(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"alpha", "2020-01,1"},
+		{"alpha,2020-02", "2"},
+		{"alpha+beta", "2020-01,4"},
+	}
+
+	idx, err := NewIndexOptions("testdata/composite.csv", IndexOptions{KeyFields: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDB("testdata/composite.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tc := range tests {
+		got, err := db.GetString(tc.key)
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.key, err.Error())
+		}
+		if got != tc.expect {
+			t.Errorf("%q => %q\n   expected %q\n", tc.key, got, tc.expect)
+		}
+	}
+}
+
+// Test DB.Get() on a key column other than the first (whole lines returned)
+func TestDBGetKeyColumn(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"alstom.com", "www.alstom.com,alstom.com,RED"},
+		{"alstom.de", "shop.alstom.de,alstom.de,RED"},
+		{"alt.com", "alt.com,alt.com,SOA"},
+	}
+
+	idx, err := NewIndexOptions("testdata/alstom_parent.csv",
+		IndexOptions{KeyColumnName: "parent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDB("testdata/alstom_parent.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tc := range tests {
+		got, err := db.GetString(tc.key)
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.key, err.Error())
+		}
+		if got != tc.expect {
+			t.Errorf("%q => %q\n   expected %q\n", tc.key, got, tc.expect)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package bsearch
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	ErrBadDialect = errors.New("dialect quote and escape must be single characters")
+)
+
+// Dialect describes the field quoting rules of a delimited dataset, for
+// datasets with quoted fields that may contain the delimiter (e.g.
+// `"Acme, Inc",Boston`). Keys are unquoted before being indexed and
+// compared, so lookups use unquoted keys (e.g. "Acme, Inc").
+type Dialect struct {
+	Quote      string `json:",omitempty"` // quote character (e.g. `"`)
+	Escape     string `json:",omitempty"` // character escaping quotes in quoted fields (default: doubled quotes, as in RFC 4180)
+	LazyQuotes bool   `json:",omitempty"` // quotes in quoted fields need not be escaped, if not followed by a delimiter
+	MultiLine  bool   `json:",omitempty"` // quoted fields may contain newlines, so records may span multiple lines
+}
+
+// RFC4180 is the standard CSV Dialect, with fields optionally quoted by
+// '"', and quotes within quoted fields escaped by doubling them.
+var RFC4180 = Dialect{Quote: `"`}
+
+// check returns ErrBadDialect if d is invalid
+func (d *Dialect) check() error {
+	if len(d.Quote) != 1 || len(d.Escape) > 1 {
+		return ErrBadDialect
+	}
+	return nil
+}
+
+// equal returns true if d and d2 describe the same Dialect (where nil, or
+// an empty Quote, means no quoting)
+func (d *Dialect) equal(d2 *Dialect) bool {
+	if d == nil || d.Quote == "" {
+		return d2 == nil || d2.Quote == ""
+	}
+	return d2 != nil && *d == *d2
+}
+
+// splitField returns the first field of line, unquoted according to the
+// index Dialect, and the remainder of line following its delimiter (more
+// is false if there is no delimiter, and so no more fields). Fields are
+// only copied if they contain escaped quotes; otherwise field points into
+// line. Unquoted fields are returned verbatim, as is any text following a
+// closing quote (or with LazyQuotes, a quote not followed by a delimiter
+// is treated as a literal quote). Unterminated quoted fields extend to the
+// end of line.
+func (i *Index) splitField(line []byte) (field, rest []byte, more bool) {
+	if len(line) == 0 || line[0] != i.Dialect.Quote[0] {
+		d := bytes.Index(line, i.Delimiter)
+		if d == -1 {
+			return line, nil, false
+		}
+		return line[:d], line[d+len(i.Delimiter):], true
+	}
+
+	quote := i.Dialect.Quote[0]
+	escape := quote
+	if i.Dialect.Escape != "" {
+		escape = i.Dialect.Escape[0]
+	}
+	var buf []byte // unescaped field, if required
+	start := 1
+	for j := 1; j < len(line); j++ {
+		c := line[j]
+		// Escaped quote (or escaped escape)
+		if c == escape && j+1 < len(line) &&
+			(line[j+1] == quote || escape != quote && line[j+1] == escape) {
+			buf = append(buf, line[start:j]...)
+			start = j + 1
+			j++
+			continue
+		}
+		if c != quote {
+			continue
+		}
+		next := line[j+1:]
+		if i.Dialect.LazyQuotes && len(next) > 0 && !bytes.HasPrefix(next, i.Delimiter) {
+			continue
+		}
+
+		// Closing quote - any text up to the next delimiter is appended
+		field = line[start:j]
+		if buf != nil {
+			field = append(buf, field...)
+		}
+		d := bytes.Index(next, i.Delimiter)
+		if d == -1 {
+			if len(next) > 0 {
+				field = append(append([]byte{}, field...), next...)
+			}
+			return field, nil, false
+		}
+		if d > 0 {
+			field = append(append([]byte{}, field...), next[:d]...)
+		}
+		return field, next[d+len(i.Delimiter):], true
+	}
+
+	// Unterminated quoted field
+	field = line[start:]
+	if buf != nil {
+		field = append(buf, field...)
+	}
+	return field, nil, false
+}
+
+// quotedLineKey is the lineKey implementation for datasets with a Dialect.
+// Composite keys are joined by the delimiter (so are copied).
+func (i *Index) quotedLineKey(line []byte) []byte {
+	more := true
+	for n := 0; n < i.KeyColumn; n++ {
+		if !more {
+			return line[:0]
+		}
+		_, line, more = i.splitField(line)
+	}
+	if !more {
+		return line[:0]
+	}
+
+	key, line, more := i.splitField(line)
+	for n := 1; n < i.KeyFields && more; n++ {
+		var field []byte
+		field, line, more = i.splitField(line)
+		key = append(append(append([]byte{}, key...), i.Delimiter...), field...)
+	}
+	return key
+}
+
+// quotedLineField is the lineField implementation for datasets with a
+// Dialect.
+func (i *Index) quotedLineField(line []byte, n int) []byte {
+	more := true
+	for ; n > 0; n-- {
+		if !more {
+			return nil
+		}
+		_, line, more = i.splitField(line)
+	}
+	if !more {
+		return nil
+	}
+	field, _, _ := i.splitField(line)
+	return field
+}
+
+// lineFields returns all the (unquoted) fields of line.
+func (i *Index) lineFields(line []byte) []string {
+	var fields []string
+	more := true
+	for more {
+		var field []byte
+		field, line, more = i.splitField(line)
+		fields = append(fields, string(field))
+	}
+	return fields
+}
+
+// trimKey returns line with its leading key field(s) and delimiter
+// removed, where the (unquoted) key is keyLen bytes long.
+func (i *Index) trimKey(line []byte, keyLen int) []byte {
+	n := 0
+	for {
+		field, rest, more := i.splitField(line)
+		n += len(field)
+		if n >= keyLen || !more {
+			return rest
+		}
+		n += len(i.Delimiter)
+		line = rest
+	}
+}
+
+// multiLine returns true if records may span multiple lines
+func (i *Index) multiLine() bool {
+	return i.Dialect != nil && i.Dialect.MultiLine
+}
+
+// recordEnd returns the position in data of the newline terminating the
+// record beginning at data[0] i.e. the first newline not within a quoted
+// field, or -1 if data does not contain the end of the record (or if
+// !atEOF, if more data is required to be sure).
+func (i *Index) recordEnd(data []byte, atEOF bool) int {
+	quote := i.Dialect.Quote[0]
+	escape := quote
+	if i.Dialect.Escape != "" {
+		escape = i.Dialect.Escape[0]
+	}
+
+	// Lookahead at data[j] requires more data if we're at the end
+	need := func(j int) bool { return j >= len(data) && !atEOF }
+	fieldStart, quoted := true, false
+	for j := 0; j < len(data); j++ {
+		c := data[j]
+		if quoted {
+			if c != quote && c != escape {
+				continue
+			}
+			if need(j + 1) {
+				return -1
+			}
+			// Escaped quote (or escaped escape) - skip both
+			if j+1 < len(data) &&
+				(data[j+1] == quote || escape != quote && data[j+1] == escape) {
+				j++
+				continue
+			}
+			if c != quote {
+				continue
+			}
+			if i.Dialect.LazyQuotes && j+1 < len(data) && data[j+1] != '\n' {
+				if need(j + 1 + len(i.Delimiter)) {
+					return -1
+				}
+				if !bytes.HasPrefix(data[j+1:], i.Delimiter) {
+					continue
+				}
+			}
+			// Closing quote
+			quoted = false
+			continue
+		}
+
+		switch {
+		case c == '\n':
+			return j
+		case fieldStart && c == quote:
+			quoted = true
+			fieldStart = false
+		case c == i.Delimiter[0]:
+			if need(j + len(i.Delimiter)) {
+				return -1
+			}
+			fieldStart = bytes.HasPrefix(data[j:], i.Delimiter)
+			if fieldStart {
+				j += len(i.Delimiter) - 1
+			}
+		default:
+			fieldStart = false
+		}
+	}
+	return -1
+}
+
+// ScanRecords is a bufio.SplitFunc that splits data into records (without
+// trailing newlines) according to the index Dialect, for use with a
+// bufio.Scanner. Records are lines, unless the Dialect is MultiLine, in
+// which case quoted fields may include newlines, or the index has a
+// FixedWidth RecordLength, in which case records are fixed-length (and any
+// trailing partial record is skipped).
+func (i *Index) ScanRecords(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if rl := int(i.recordLength()); rl > 0 {
+		switch {
+		case len(data) >= rl:
+			return rl, data[:rl], nil
+		case atEOF:
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	}
+	end := -1
+	if i.multiLine() {
+		end = i.recordEnd(data, atEOF)
+	} else {
+		end = bytes.IndexByte(data, '\n')
+	}
+	if end >= 0 {
+		return end + 1, data[:end], nil
+	}
+	// Final unterminated record
+	if atEOF {
+		return len(data), data, nil
+	}
+	// Request more data
+	return 0, nil, nil
+}
+
+// Key returns the key of the dataset record line, as used by the index
+// (e.g. for composite or quoted keys, see IndexOptions).
+func (i *Index) Key(line []byte) []byte {
+	return i.lineKey(line)
+}
@@ -0,0 +1,233 @@
+package bsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitField(t *testing.T) {
+	rfc4180 := &Index{Delimiter: []byte(","), Dialect: &Dialect{Quote: `"`}}
+	lazy := &Index{Delimiter: []byte(","), Dialect: &Dialect{Quote: `"`, LazyQuotes: true}}
+	escaped := &Index{Delimiter: []byte("|"), Dialect: &Dialect{Quote: `'`, Escape: `\`}}
+
+	var tests = []struct {
+		index *Index
+		line  string
+		field string
+		rest  string
+		more  bool
+	}{
+		{rfc4180, `abc,def`, `abc`, `def`, true},
+		{rfc4180, `abc`, `abc`, ``, false},
+		{rfc4180, ``, ``, ``, false},
+		{rfc4180, `"a,b",c`, `a,b`, `c`, true},
+		{rfc4180, `"a""b",c`, `a"b`, `c`, true},
+		{rfc4180, `"a,b"`, `a,b`, ``, false},
+		{rfc4180, `"",c`, ``, `c`, true},
+		{rfc4180, `a"b,c`, `a"b`, `c`, true},
+		{rfc4180, `"a"b,c`, `ab`, `c`, true},
+		{rfc4180, `"a,b`, `a,b`, ``, false},
+		{lazy, `"a"b",c`, `a"b`, `c`, true},
+		{lazy, `"a "b" c",d`, `a "b" c`, `d`, true},
+		{escaped, `'a|b'|c`, `a|b`, `c`, true},
+		{escaped, `'it\'s'|c`, `it's`, `c`, true},
+		{escaped, `'a\\'|c`, `a\`, `c`, true},
+		{escaped, `'a''b'|c`, `a'b'`, `c`, true},
+	}
+
+	for _, tc := range tests {
+		field, rest, more := tc.index.splitField([]byte(tc.line))
+		assert.Equal(t, tc.field, string(field), tc.line+" field")
+		assert.Equal(t, tc.rest, string(rest), tc.line+" rest")
+		assert.Equal(t, tc.more, more, tc.line+" more")
+	}
+}
+
+// Test Searcher lookups on testdata/quoted.csv (with quoted keys)
+func TestSearcherDialect(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"Acme", []string{"Acme,Austin,3"}},
+		{"Acme, Inc", []string{`"Acme, Inc",Boston,1`, `"Acme, Inc",Denver,2`}},
+		{"Acme,Inc", []string{`"Acme,Inc",Chicago,4`}},
+		{`Bob "The Builder"`, []string{`"Bob ""The Builder""",Leeds,5`}},
+		{"Zed", []string{`Zed,"York, UK",6`}},
+		{`"Acme, Inc"`, nil},
+		{"Acme, In", nil},
+	}
+
+	_, err := NewIndexOptions("testdata/quoted.csv", IndexOptions{
+		Header:  true,
+		Dialect: &Dialect{Quote: `"'`},
+	})
+	assert.Equal(t, ErrBadDialect, err)
+
+	writeIndexOptions(t, "quoted.csv",
+		IndexOptions{Header: true, Dialect: &RFC4180, Blocksize: 32})
+	s, err := NewSearcherOptions("testdata/quoted.csv",
+		SearcherOptions{Dialect: &RFC4180})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, []string{"name", "city", "n"}, s.Index.HeaderFields)
+	assert.Equal(t, true, len(s.Index.List) > 1)
+	for _, e := range s.Index.List {
+		assert.NotEqual(t, `"`, e.Key[:1], "index keys are unquoted")
+	}
+
+	for _, tc := range tests {
+		lines, err := s.Lines([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+			continue
+		}
+		assert.Nil(t, err, tc.key)
+		got := []string{}
+		for _, l := range lines {
+			got = append(got, string(l))
+		}
+		assert.Equal(t, tc.expect, got, tc.key)
+	}
+
+	lines, err := s.PrefixLines([]byte("Acme,"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(lines), "PrefixLines Acme,")
+
+	_, err = NewSearcherOptions("testdata/quoted.csv",
+		SearcherOptions{Dialect: &Dialect{Quote: `'`}})
+	assert.Equal(t, ErrIndexDialectMismatch, err)
+}
+
+// Test DB lookups on quoted datasets
+func TestDBDialect(t *testing.T) {
+	var tests = []struct {
+		file    string
+		dialect Dialect
+		key     string
+		expect  []string
+	}{
+		{"quoted.csv", RFC4180, "Acme, Inc", []string{"Boston", "1"}},
+		{"quoted.csv", RFC4180, `Bob "The Builder"`, []string{"Leeds", "5"}},
+		{"quoted.csv", RFC4180, "Zed", []string{"York, UK", "6"}},
+		{"quoted.psv", Dialect{Quote: `'`, Escape: `\`}, "Acme|Inc", []string{"1"}},
+		{"quoted.psv", Dialect{Quote: `'`, Escape: `\`}, "It's", []string{"2"}},
+		{"quoted.psv", Dialect{Quote: `'`, Escape: `\`}, "plain", []string{"3"}},
+		{"multiline.csv", Dialect{Quote: `"`, MultiLine: true}, "alpha", []string{"first line\nbeta,fake record", "1"}},
+		{"multiline.csv", Dialect{Quote: `"`, MultiLine: true}, "ca\nrrot", []string{"two line key", "3"}},
+	}
+
+	for _, tc := range tests {
+		writeIndexOptions(t, tc.file, IndexOptions{Dialect: &tc.dialect})
+		db, err := NewDB("testdata/" + tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.GetSlice(tc.key)
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, tc.expect, got, tc.key)
+		db.Close()
+	}
+}
+
+func TestRecordEnd(t *testing.T) {
+	rfc4180 := &Index{Delimiter: []byte(","), Dialect: &Dialect{Quote: `"`, MultiLine: true}}
+	lazy := &Index{Delimiter: []byte(","), Dialect: &Dialect{Quote: `"`, LazyQuotes: true, MultiLine: true}}
+	escaped := &Index{Delimiter: []byte("||"), Dialect: &Dialect{Quote: `'`, Escape: `\`, MultiLine: true}}
+
+	var tests = []struct {
+		index  *Index
+		data   string
+		atEOF  bool
+		expect int
+	}{
+		{rfc4180, "a,b\nc", false, 3},
+		{rfc4180, "a,b", false, -1},
+		{rfc4180, "a,b", true, -1},
+		{rfc4180, "\"a\nb\",c\nd", false, 7},
+		{rfc4180, "a,\"b\n\"\"\nc\"\nd", false, 10},
+		{rfc4180, "a\"b\nc\",d\n", true, 3},
+		{rfc4180, "\"a\nb", true, -1},
+		{rfc4180, "\"a\"", false, -1},
+		{rfc4180, "\"a\"\n", false, 3},
+		{lazy, "\"a\"b\nc\",d\n", true, 9},
+		{lazy, "\"a\"\nb", true, 3},
+		{escaped, "'a\\'\nb'||c\nd", true, 10},
+		{escaped, "'a\\\\'||b\nc", true, 8},
+		{escaped, "a|'b\n", true, 4},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expect, tc.index.recordEnd([]byte(tc.data), tc.atEOF), tc.data)
+	}
+}
+
+// Test Searcher lookups on testdata/multiline.csv (with quoted newlines)
+func TestSearcherMultiLine(t *testing.T) {
+	records := []string{
+		"alpha,\"first line\nbeta,fake record\",1",
+		"beta,plain,2",
+		"\"ca\nrrot\",two line key,3",
+		"delta,\"a \"\"quoted\"\"\nmulti\nline note\",4",
+		"echo,last,5",
+	}
+	dialect := &Dialect{Quote: `"`, MultiLine: true}
+	writeIndexOptions(t, "multiline.csv",
+		IndexOptions{Header: true, Dialect: dialect, Blocksize: 48})
+	s, err := NewSearcherOptions("testdata/multiline.csv",
+		SearcherOptions{Dialect: dialect, LineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, true, len(s.Index.List) > 1)
+	for _, e := range s.Index.List {
+		assert.NotEqual(t, "beta,fake record", e.Key, "index entries are record starts")
+	}
+
+	// Lookups
+	for i, key := range []string{"alpha", "beta", "ca\nrrot", "delta", "echo"} {
+		lines, err := s.Lines([]byte(key))
+		assert.Nil(t, err, key)
+		assert.Equal(t, [][]byte{[]byte(records[i])}, lines, key)
+
+		rank, err := s.Rank([]byte(key))
+		assert.Nil(t, err, key)
+		assert.Equal(t, i, rank, key)
+
+		line, err := s.Nth(i)
+		assert.Nil(t, err, key)
+		assert.Equal(t, records[i], string(line), key)
+	}
+	_, err = s.Line([]byte("beta,fake record"))
+	assert.Equal(t, ErrNotFound, err)
+
+	// Line numbers are physical line numbers
+	for _, tc := range []struct {
+		key  string
+		line int64
+	}{{"alpha", 2}, {"beta", 4}, {"ca\nrrot", 5}, {"delta", 7}, {"echo", 10}} {
+		matches, err := s.Matches([]byte(tc.key))
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, tc.line, matches[0].LineNumber, tc.key)
+	}
+
+	// Iteration in both directions returns whole records
+	c, err := s.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for ok := c.First(); ok; ok = c.Next() {
+		got = append(got, string(c.Line()))
+	}
+	assert.Equal(t, records, got)
+	got = []string{}
+	for ok := c.Last(); ok; ok = c.Prev() {
+		got = append([]string{string(c.Line())}, got...)
+	}
+	assert.Equal(t, records, got)
+}
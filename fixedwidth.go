@@ -0,0 +1,136 @@
+package bsearch
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	ErrBadFixedWidth           = errors.New("invalid fixed-width layout")
+	ErrFixedWidthOptions       = errors.New("fixed-width layouts cannot be used with delimiters, key columns, dialects, or whole-line keys")
+	ErrIndexFixedWidthMismatch = errors.New("index fixed-width layout mismatch")
+)
+
+// FixedWidth describes the layout of fixed-width datasets, whose keys are
+// at a fixed byte position in each record, rather than being delimited
+// (e.g. mainframe-style extracts). Fields are padded with trailing spaces,
+// which are trimmed from keys and from Columns values. If RecordLength is
+// set, records are exactly RecordLength bytes long, with no newlines, so
+// record offsets can be computed directly (and any trailing partial record
+// is ignored).
+type FixedWidth struct {
+	KeyOffset    int   `json:",omitempty"` // byte offset of the key within records
+	KeyLength    int   // key length in bytes
+	RecordLength int   `json:",omitempty"` // record length, for datasets without newlines
+	Columns      []int `json:",omitempty"` // column widths in bytes, for splitting records (e.g. by DB.GetSlice)
+}
+
+// check returns ErrBadFixedWidth if f is invalid
+func (f *FixedWidth) check() error {
+	if f.KeyOffset < 0 || f.KeyLength <= 0 || f.RecordLength < 0 ||
+		f.RecordLength > 0 && f.KeyOffset+f.KeyLength > f.RecordLength {
+		return ErrBadFixedWidth
+	}
+	width := 0
+	for _, w := range f.Columns {
+		if w <= 0 {
+			return ErrBadFixedWidth
+		}
+		width += w
+	}
+	if f.RecordLength > 0 && width > f.RecordLength {
+		return ErrBadFixedWidth
+	}
+	return nil
+}
+
+// copy returns a (deep) copy of f
+func (f *FixedWidth) copy() *FixedWidth {
+	c := *f
+	c.Columns = append([]int(nil), f.Columns...)
+	return &c
+}
+
+// equal returns true if f and f2 are the same layout
+func (f *FixedWidth) equal(f2 *FixedWidth) bool {
+	if f == nil || f2 == nil {
+		return f == f2
+	}
+	if f.KeyOffset != f2.KeyOffset || f.KeyLength != f2.KeyLength ||
+		f.RecordLength != f2.RecordLength || len(f.Columns) != len(f2.Columns) {
+		return false
+	}
+	for n, w := range f.Columns {
+		if w != f2.Columns[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// recordLength returns the fixed record length of the dataset, or 0 if
+// records are newline-terminated
+func (i *Index) recordLength() int64 {
+	if i.FixedWidth == nil {
+		return 0
+	}
+	return int64(i.FixedWidth.RecordLength)
+}
+
+// padded returns the length bytes of record beginning at start (or fewer,
+// if record is shorter), trimmed of trailing padding
+func padded(record []byte, start, length int) []byte {
+	if start > len(record) {
+		start = len(record)
+	}
+	end := start + length
+	if end > len(record) {
+		end = len(record)
+	}
+	return bytes.TrimRight(record[start:end], " ")
+}
+
+// key returns the key of record
+func (f *FixedWidth) key(record []byte) []byte {
+	return padded(record, f.KeyOffset, f.KeyLength)
+}
+
+// column returns column n (0-based) of record, or nil if there is no such
+// column.
+func (f *FixedWidth) column(record []byte, n int) []byte {
+	if n < 0 || n >= len(f.Columns) {
+		return nil
+	}
+	start := 0
+	for _, w := range f.Columns[:n] {
+		start += w
+	}
+	return padded(record, start, f.Columns[n])
+}
+
+// valueStart returns the offset of DB values within records i.e. following
+// the key, if it begins the record, and otherwise 0 (the whole record).
+func (f *FixedWidth) valueStart() int {
+	if f.KeyOffset > 0 {
+		return 0
+	}
+	return f.KeyLength
+}
+
+// fields returns the Columns of value, which begins at byte start of its
+// record, omitting any columns preceding start. Without Columns, value is
+// a single field.
+func (f *FixedWidth) fields(value []byte, start int) []string {
+	if len(f.Columns) == 0 {
+		return []string{string(bytes.TrimRight(value, " "))}
+	}
+	fields := []string{}
+	pos := 0
+	for _, w := range f.Columns {
+		if pos >= start {
+			fields = append(fields, string(padded(value, pos-start, w)))
+		}
+		pos += w
+	}
+	return fields
+}
@@ -0,0 +1,165 @@
+package bsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedWidthCheck(t *testing.T) {
+	var tests = []struct {
+		layout FixedWidth
+		err    error
+	}{
+		{FixedWidth{KeyLength: 6}, nil},
+		{FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16, Columns: []int{4, 6, 6}}, nil},
+		{FixedWidth{}, ErrBadFixedWidth},
+		{FixedWidth{KeyOffset: -1, KeyLength: 6}, ErrBadFixedWidth},
+		{FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 8}, ErrBadFixedWidth},
+		{FixedWidth{KeyLength: 6, Columns: []int{6, 0}}, ErrBadFixedWidth},
+		{FixedWidth{KeyLength: 6, RecordLength: 16, Columns: []int{6, 6, 6}}, ErrBadFixedWidth},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.err, tc.layout.check(), "%+v", tc.layout)
+	}
+
+	_, err := NewIndexOptions("testdata/fixed.dat", IndexOptions{
+		Delimiter:  []byte(","),
+		FixedWidth: &FixedWidth{KeyLength: 6},
+	})
+	assert.Equal(t, ErrFixedWidthOptions, err)
+}
+
+// Test Searcher lookups on testdata/fixed.dat (newline-terminated, with the
+// key in bytes 0-6) and testdata/fixed.rec (16-byte records without
+// newlines, with the key in bytes 4-10)
+func TestSearcherFixedWidth(t *testing.T) {
+	var tests = []struct {
+		file   string
+		layout FixedWidth
+		key    string
+		expect []string
+	}{
+		{"fixed.dat", FixedWidth{KeyLength: 6}, "A1", []string{"A1    Alpha     0001"}},
+		{"fixed.dat", FixedWidth{KeyLength: 6}, "B2", []string{"B2    Gamma     0003", "B2    Delta     0004"}},
+		{"fixed.dat", FixedWidth{KeyLength: 6}, "F6", []string{"F6    Theta     0008"}},
+		{"fixed.dat", FixedWidth{KeyLength: 6}, "A", nil},
+		{"fixed.dat", FixedWidth{KeyLength: 6}, "B2    Gamma", nil},
+		{"fixed.rec", FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16}, "A1", []string{"0001A1    000001"}},
+		{"fixed.rec", FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16}, "B2", []string{"0003B2    000003", "0004B2    000004"}},
+		{"fixed.rec", FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16}, "C333", []string{"0005C333  000005"}},
+		{"fixed.rec", FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16}, "F6", []string{"0008F6    000008"}},
+		{"fixed.rec", FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16}, "0001", nil},
+	}
+
+	for _, tc := range tests {
+		writeIndexOptions(t, tc.file, IndexOptions{
+			FixedWidth: &tc.layout,
+			Header:     tc.file == "fixed.dat",
+			Blocksize:  32,
+		})
+		s, err := NewSearcher("testdata/" + tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines, err := s.Lines([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.file+" "+tc.key)
+		} else {
+			assert.Nil(t, err, tc.file+" "+tc.key)
+			got := []string{}
+			for _, l := range lines {
+				got = append(got, string(l))
+			}
+			assert.Equal(t, tc.expect, got, tc.file+" "+tc.key)
+		}
+		s.Close()
+	}
+
+	// Fixed-length records are located directly
+	s, err := NewSearcherOptions("testdata/fixed.rec", SearcherOptions{LineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, true, len(s.Index.List) > 1)
+
+	line, err := s.Nth(4)
+	assert.Nil(t, err)
+	assert.Equal(t, "0005C333  000005", string(line))
+	_, err = s.Nth(8)
+	assert.Equal(t, ErrNotFound, err, "trailing partial record is ignored")
+	rank, err := s.Rank([]byte("C333"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, rank)
+	line, err = s.Floor([]byte("B3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0003B2    000003", string(line))
+	line, err = s.Ceiling([]byte("B3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0005C333  000005", string(line))
+	matches, err := s.Matches([]byte("D4"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), matches[0].LineNumber)
+
+	c, err := s.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, c.Last())
+	assert.Equal(t, "0008F6    000008", string(c.Line()))
+	assert.Equal(t, true, c.Prev())
+	assert.Equal(t, "0007E5    000007", string(c.Line()))
+
+	s2, err := NewSearcherOptions("testdata/fixed.rec", SearcherOptions{
+		FixedWidth: &FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16},
+	})
+	if assert.Nil(t, err) {
+		s2.Close()
+	}
+	_, err = NewSearcherOptions("testdata/fixed.rec", SearcherOptions{
+		FixedWidth: &FixedWidth{KeyLength: 6, RecordLength: 16},
+	})
+	assert.Equal(t, ErrIndexFixedWidthMismatch, err)
+	_, err = NewSearcherOptions("testdata/fixed.rec", SearcherOptions{
+		FixedWidth: &FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16, Columns: []int{4, 6, 6}},
+	})
+	assert.Equal(t, ErrIndexFixedWidthMismatch, err)
+	_, err = NewSearcherOptions("testdata/fixed.dat", SearcherOptions{
+		FixedWidth: &FixedWidth{KeyLength: 8},
+	})
+	assert.Equal(t, ErrIndexFixedWidthMismatch, err)
+}
+
+// Test DB lookups on fixed-width datasets
+func TestDBFixedWidth(t *testing.T) {
+	var tests = []struct {
+		file   string
+		layout FixedWidth
+		header bool
+		key    string
+		expect []string
+	}{
+		{"fixed.dat", FixedWidth{KeyLength: 6, Columns: []int{6, 10, 4}}, true, "A10", []string{"Beta", "0002"}},
+		{"fixed.dat", FixedWidth{KeyLength: 6, Columns: []int{6, 10, 4}}, true, "C333", []string{"Epsilon", "0005"}},
+		{"fixed.dat", FixedWidth{KeyLength: 6}, true, "D4", []string{"Zeta      0006"}},
+		{"fixed.rec", FixedWidth{KeyOffset: 4, KeyLength: 6, RecordLength: 16, Columns: []int{4, 6, 6}}, false,
+			"E5", []string{"0007", "E5", "000007"}},
+	}
+
+	for _, tc := range tests {
+		writeIndexOptions(t, tc.file, IndexOptions{FixedWidth: &tc.layout, Header: tc.header})
+		db, err := NewDB("testdata/" + tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tc.layout.Columns) > 0 && tc.header {
+			assert.Equal(t, []string{"ID", "NAME", "QTY"}, db.bss.Index.HeaderFields, tc.file)
+		}
+		got, err := db.GetSlice(tc.key)
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, tc.expect, got, tc.key)
+		db.Close()
+	}
+}
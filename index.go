@@ -20,14 +20,16 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
 )
 
 const (
-	indexVersion     = 4
+	indexVersion     = 6
 	indexSuffix      = "bsy"
 	defaultBlocksize = 2048
 	recordSeparator  = '\n'
@@ -35,43 +37,74 @@ const (
 )
 
 var (
-	ErrIndexNotFound     = errors.New("index file not found")
-	ErrIndexExpired      = errors.New("index file out of date")
-	ErrIndexEmpty        = errors.New("index contains no entries")
-	ErrIndexPathMismatch = errors.New("index file path mismatch")
+	ErrIndexNotFound          = errors.New("index file not found")
+	ErrIndexExpired           = errors.New("index file out of date")
+	ErrIndexEmpty             = errors.New("index contains no entries")
+	ErrIndexPathMismatch      = errors.New("index file path mismatch")
+	ErrKeyColumnNotFound      = errors.New("key column not found in header")
+	ErrIndexKeyColumnMismatch = errors.New("index key column mismatch")
+	ErrIndexDialectMismatch   = errors.New("index dialect mismatch")
+	ErrBadDelimiter           = errors.New("delimiter must not contain newlines")
+	ErrWholeLineOptions       = errors.New("whole-line keys cannot be used with delimiters, key columns, or dialects")
+	ErrIndexWholeLineMismatch = errors.New("index whole-line mismatch")
 )
 
 type IndexOptions struct {
-	Blocksize int
-	Delimiter []byte
-	Header    bool
-	Logger    *zerolog.Logger // debug logger
+	Blocksize     int
+	Comparator    Comparator  // key ordering (default Bytewise)
+	Delimiter     []byte      // field delimiter (default derived from the filename, see Index.Delimiter)
+	Dialect       *Dialect    // field quoting rules (default none)
+	FixedWidth    *FixedWidth // fixed-width layout, for undelimited datasets (default none)
+	Header        bool
+	KeyColumn     int             // (0-based) field number of the (first) key field (default 0)
+	KeyColumnName string          // header field name of the (first) key field (implies Header)
+	KeyFields     int             // number of leading fields forming the key (default 1)
+	KeysReversed  bool            // dataset keys are reversed (e.g. reversed domain names)
+	Logger        *zerolog.Logger // debug logger
+	WholeLine     bool            // lines are keys, with no fields (default for .txt, .lst, and extensionless files)
 }
 
 type IndexEntry struct {
 	Key    string
 	Offset int64 // file offset for start-of-block
+	Lines  int   // number of lines in block (index version 5+)
 }
 
 // Index provides index metadata for the filepath dataset
 type Index struct {
-	Blocksize int
-	// FIXME: Delimiter should really be a rune, not an arbitrarily-length []byte
-	// Can we change without bumping the index version?
+	Blocksize  int
+	Comparator string `json:",omitempty"` // key Comparator name (default Bytewise)
+	// Delimiter is the field delimiter, which is usually a single rune
+	// (e.g. ',', '\x1f' or 'þ'), but may be a multi-rune string (e.g. "::"),
+	// or raw bytes that aren't valid UTF-8 (e.g. a Latin-1 "\xfe").
+	// Single rune delimiters are supported everywhere, whereas with other
+	// delimiters, fields cannot be quoted for DB.GetSlice and header
+	// parsing, and are just split on the delimiter. Version 6+ indices
+	// record Delimiter as a string, or if not valid UTF-8, as an array of
+	// byte values (older ones used base64).
 	Delimiter []byte
-	Epoch     int64
+	Dialect   *Dialect `json:",omitempty"` // field quoting rules (nil for none)
+	// FixedWidth is the fixed-width layout of undelimited datasets (nil for none)
+	FixedWidth *FixedWidth `json:",omitempty"`
+	Epoch      int64
 	// Filepath is no longer exported (it is explicitly emptied in Write()),
 	// but we keep it capitalised to accept old indices that used it
 	// instead of Filename
 	Filepath       string `json:",omitempty"`
 	Filename       string
 	Header         bool
+	KeyColumn      int `json:",omitempty"` // (0-based) field number of the (first) key field
+	KeyFields      int `json:",omitempty"` // number of leading fields forming the key (0 means 1)
 	KeysIndexFirst bool
+	KeysReversed   bool `json:",omitempty"` // keys are reversed, so search keys must be too
 	KeysUnique     bool
 	Length         int
 	List           []IndexEntry `json:"-"`
 	Version        int
 	HeaderFields   []string        `json:",omitempty"`
+	WholeLine      bool            `json:",omitempty"` // lines are keys, with no fields (like look(1))
+	comparator     Comparator      // key Comparator (nil for Bytewise)
+	keyColumnName  string          // KeyColumnName option, resolved from HeaderFields
 	logger         *zerolog.Logger // debug logger
 }
 
@@ -120,9 +153,16 @@ func deriveDelimiter(filename string) ([]byte, error) {
 	return []byte{}, ErrUnknownDelimiter
 }
 
-func csvSplitBytes(line []byte, delim string) ([]string, error) {
+// deriveWholeLine returns true if filename looks like a word list (a .txt
+// or .lst file, or one without an extension), whose lines are keys
+func deriveWholeLine(filename string) bool {
+	reWords := regexp.MustCompile(`\.(txt|lst)(\.zst)?$`)
+	return reWords.MatchString(filename) || filepath.Ext(filename) == ""
+}
+
+func csvSplitBytes(line []byte, delim rune) ([]string, error) {
 	reader := csv.NewReader(bytes.NewReader(line))
-	reader.Comma = rune(delim[0])
+	reader.Comma = delim
 	s, err := reader.Read()
 	if err != nil {
 		return []string{}, err
@@ -130,6 +170,36 @@ func csvSplitBytes(line []byte, delim string) ([]string, error) {
 	return s, nil
 }
 
+// delimiterRune returns Delimiter as a rune, and true if it is a single
+// rune, or false if not.
+func (i *Index) delimiterRune() (rune, bool) {
+	r, n := utf8.DecodeRune(i.Delimiter)
+	if r == utf8.RuneError || n != len(i.Delimiter) {
+		return 0, false
+	}
+	return r, true
+}
+
+// splitFields returns the fields of line (e.g. the header line), unquoted
+// according to the index Dialect if set, and otherwise read using a
+// csv.Reader for single rune delimiters, or split on multi-rune ones.
+func (i *Index) splitFields(line []byte) ([]string, error) {
+	if i.WholeLine {
+		return []string{string(line)}, nil
+	}
+	if i.FixedWidth != nil {
+		return i.FixedWidth.fields(line, 0), nil
+	}
+	if i.Dialect != nil {
+		return i.lineFields(line), nil
+	}
+	delim, ok := i.delimiterRune()
+	if !ok {
+		return strings.Split(string(line), string(i.Delimiter)), nil
+	}
+	return csvSplitBytes(line, delim)
+}
+
 // generateLineIndex processes the input from reader line-by-line,
 // generating index entries for the first full line in each block
 // (or the first instance of that key, if repeating)
@@ -142,18 +212,30 @@ func generateLineIndex(index *Index, reader io.ReaderAt) error {
 	// blockNumber: The ordinal number of the current block
 	// prevKey:
 	// firstOffset:
+	// dupLines: The number of lines since firstOffset (i.e. with prevKey)
 	// skipHeader: Set to true if the file contains a header that should be skipped
 	//
 	// Process dataset line-by-line
 	buf := make([]byte, index.Blocksize)
 	scanner := bufio.NewScanner(reader.(io.Reader))
 	scanner.Buffer(buf, index.Blocksize)
+	if index.multiLine() || index.recordLength() > 0 {
+		// Scan whole (possibly multi-line, or fixed-length) records, so
+		// that index entries only ever point to record starts
+		scanner.Split(index.ScanRecords)
+	}
+	// Fixed-length records have no newline terminators
+	var terminator int64 = 1
+	if index.recordLength() > 0 {
+		terminator = 0
+	}
 	list := []IndexEntry{}
 	var blockPosition int64 = 0
 	var blockNumber int64 = -1
 	prevKey := []byte{}
 	prevLine := []byte{}
 	var firstOffset int64 = -1
+	dupLines := 0
 	index.KeysUnique = true
 	skipHeader := index.Header
 	for scanner.Scan() {
@@ -163,17 +245,20 @@ func generateLineIndex(index *Index, reader io.ReaderAt) error {
 			// If index.Header is set, skip the first line of the dataset,
 			// begin indexing from the second
 			skipHeader = false
-			blockPosition += int64(len(line) + 1)
-			fields, err := csvSplitBytes(line, string(index.Delimiter))
+			blockPosition += int64(len(line)) + terminator
+			fields, err := index.splitFields(line)
 			if err != nil {
 				return err
 			}
 			index.HeaderFields = fields
+			err = index.setKeyColumn()
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
-		elt := bytes.SplitN(line, index.Delimiter, 2)
-		key := elt[0]
+		key := index.lineKey(line)
 		if index.logger != nil {
 			index.logger.Debug().
 				Int64("blockNumber", blockNumber).
@@ -183,15 +268,20 @@ func generateLineIndex(index *Index, reader io.ReaderAt) error {
 				Msg("generateLineIndex loop")
 		}
 
-		// Check key ordering
+		// Check key ordering (the first line has no prevKey, which matters
+		// for empty keys, and Comparators that treat any keys as empty)
 		dupKeyBlock := false
-		switch bytes.Compare(prevKey, key) {
+		cmp := -1
+		if firstOffset > -1 {
+			cmp = index.compare(prevKey, key)
+		}
+		switch cmp {
 		case 1:
 			// Special case - allow second record out-of-order due to header
 			// FIXME: should we have an option to disallow this?
 			if blockNumber == 0 && !index.Header {
 				index.Header = true
-				fields, err := csvSplitBytes(prevLine, string(index.Delimiter))
+				fields, err := index.splitFields(prevLine)
 				if err != nil {
 					return err
 				}
@@ -227,20 +317,28 @@ func generateLineIndex(index *Index, reader io.ReaderAt) error {
 					Key:    string(key),
 					Offset: offset,
 				}
+				// Move any previous lines with this key to the new block
+				if dupKeyBlock {
+					list[len(list)-1].Lines -= dupLines
+					entry.Lines = dupLines
+				}
 				list = append(list, entry)
 			}
 
 			blockNumber = currentBlockNumber
 		}
 
+		list[len(list)-1].Lines++
 		if !dupKeyBlock {
 			firstOffset = blockPosition
 			prevKey = clonebs(key)
+			dupLines = 0
 		}
+		dupLines++
 		if blockNumber == 0 {
 			prevLine = clonebs(line)
 		}
-		blockPosition += int64(len(line) + 1)
+		blockPosition += int64(len(line)) + terminator
 	}
 	if err := scanner.Err(); err != nil {
 		return err
@@ -277,13 +375,29 @@ func NewIndexOptions(path string, opt IndexOptions) (*Index, error) {
 		return nil, err
 	}
 
+	// Whole-line keys are incompatible with any field options
+	wholeLine := opt.WholeLine
+	fieldOpts := len(opt.Delimiter) > 0 || opt.KeyColumn > 0 ||
+		opt.KeyColumnName != "" || opt.KeyFields > 1 || opt.Dialect != nil
+	if wholeLine && fieldOpts {
+		return nil, ErrWholeLineOptions
+	}
+	if opt.FixedWidth != nil && (fieldOpts || wholeLine) {
+		return nil, ErrFixedWidthOptions
+	}
 	delim := opt.Delimiter
-	if len(delim) == 0 {
+	if len(delim) == 0 && !wholeLine && opt.FixedWidth == nil {
 		delim, err = deriveDelimiter(path)
+		if err == ErrUnknownDelimiter && !fieldOpts && deriveWholeLine(filepath.Base(path)) {
+			wholeLine, err = true, nil
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
+	if bytes.IndexByte(delim, recordSeparator) > -1 {
+		return nil, ErrBadDelimiter
+	}
 
 	index := Index{}
 	if opt.Blocksize > 0 {
@@ -292,10 +406,39 @@ func NewIndexOptions(path string, opt IndexOptions) (*Index, error) {
 		index.Blocksize = defaultBlocksize
 	}
 	index.Delimiter = delim
+	if opt.Dialect != nil && opt.Dialect.Quote != "" {
+		err = opt.Dialect.check()
+		if err != nil {
+			return nil, err
+		}
+		dialect := *opt.Dialect
+		index.Dialect = &dialect
+	}
+	if opt.FixedWidth != nil {
+		err = opt.FixedWidth.check()
+		if err != nil {
+			return nil, err
+		}
+		index.FixedWidth = opt.FixedWidth.copy()
+	}
 	index.Epoch = epoch
 	index.Filepath = path
 	index.Filename = filepath.Base(path)
 	index.Header = opt.Header
+	index.KeyColumn = opt.KeyColumn
+	if opt.KeyColumnName != "" {
+		index.Header = true
+		index.keyColumnName = opt.KeyColumnName
+	}
+	if opt.KeyFields > 1 {
+		index.KeyFields = opt.KeyFields
+	}
+	index.KeysReversed = opt.KeysReversed
+	index.WholeLine = wholeLine
+	if opt.Comparator != nil && opt.Comparator.Name() != Bytewise.Name() {
+		index.Comparator = opt.Comparator.Name()
+		index.comparator = opt.Comparator
+	}
 	index.Version = indexVersion
 	if opt.Logger != nil {
 		index.logger = opt.Logger
@@ -309,6 +452,63 @@ func NewIndexOptions(path string, opt IndexOptions) (*Index, error) {
 	return &index, nil
 }
 
+// indexHeader is Index without its JSON methods, for encoding and decoding
+// index file header lines
+type indexHeader Index
+
+// MarshalJSON encodes i as an index file header line, with Delimiter
+// encoded as a string for version 6+ indices (or if it is not valid UTF-8,
+// e.g. a Latin-1 'þ', as an array of byte values).
+func (i Index) MarshalJSON() ([]byte, error) {
+	if i.Version < 6 {
+		return json.Marshal((*indexHeader)(&i))
+	}
+	if !utf8.Valid(i.Delimiter) {
+		delim := make([]int, len(i.Delimiter))
+		for n, b := range i.Delimiter {
+			delim[n] = int(b)
+		}
+		return json.Marshal(struct {
+			*indexHeader
+			Delimiter []int
+		}{(*indexHeader)(&i), delim})
+	}
+	return json.Marshal(struct {
+		*indexHeader
+		Delimiter string
+	}{(*indexHeader)(&i), string(i.Delimiter)})
+}
+
+// UnmarshalJSON decodes the index file header line data into i, handling
+// string and byte array (version 6+) and base64 (older versions)
+// Delimiters.
+func (i *Index) UnmarshalJSON(data []byte) error {
+	header := struct {
+		*indexHeader
+		Delimiter json.RawMessage
+	}{indexHeader: (*indexHeader)(i)}
+	err := json.Unmarshal(data, &header)
+	if err != nil || header.Delimiter == nil {
+		return err
+	}
+	if i.Version < 6 {
+		return json.Unmarshal(header.Delimiter, &i.Delimiter)
+	}
+	if header.Delimiter[0] == '[' {
+		var delim []int
+		err = json.Unmarshal(header.Delimiter, &delim)
+		i.Delimiter = make([]byte, len(delim))
+		for n, b := range delim {
+			i.Delimiter[n] = byte(b)
+		}
+		return err
+	}
+	var delim string
+	err = json.Unmarshal(header.Delimiter, &delim)
+	i.Delimiter = []byte(delim)
+	return err
+}
+
 // LoadIndex loads Index from the associated index file for path.
 // Returns ErrIndexNotFound if no index file exists.
 // Returns ErrIndexExpired if path is newer than the index file.
@@ -383,6 +583,13 @@ func LoadIndex(path string) (*Index, error) {
 		index.Version = 1
 	}
 
+	if index.Comparator != "" {
+		index.comparator, err = LookupComparator(index.Comparator)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	for counter := 0; counter < index.Length; counter++ {
 		line, err := reader.ReadString(recordSeparator)
 		lineNum := counter + 1
@@ -390,33 +597,223 @@ func LoadIndex(path string) (*Index, error) {
 			return nil, fmt.Errorf("malformed index: premature EOF on line %d", lineNum)
 		}
 		line = strings.TrimRight(line, string(recordSeparator))
-		pair := strings.SplitN(line, string(fieldSeparator), 2)
-		if len(pair) != 2 {
+		// Version 5+ indices include block line counts between offset and key
+		nfields := 2
+		if index.Version >= 5 {
+			nfields = 3
+		}
+		fields := strings.SplitN(line, string(fieldSeparator), nfields)
+		if len(fields) != nfields {
 			return nil, fmt.Errorf("malformed index: line %d (%q) contains a malformed pair", lineNum, line)
 		}
 
-		offset, err := strconv.ParseInt(pair[0], 10, 64)
+		offset, err := strconv.ParseInt(fields[0], 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("malformed index: line %d contains a bad offset: %w", lineNum, err)
 		}
-		key, err := strconv.Unquote(pair[1])
+		entry := IndexEntry{Offset: offset}
+		if nfields == 3 {
+			entry.Lines, err = strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed index: line %d contains a bad line count: %w", lineNum, err)
+			}
+		}
+		entry.Key, err = strconv.Unquote(fields[nfields-1])
 		if err != nil {
 			return nil, fmt.Errorf("malformed index: line %d contains a bad key: %w", lineNum, err)
 		}
-		index.List = append(index.List, IndexEntry{Key: key, Offset: offset})
+		index.List = append(index.List, entry)
 	}
 
 	return &index, nil
 }
 
+// setKeyColumn sets KeyColumn from the keyColumnName option (if any), using
+// HeaderFields. Returns ErrKeyColumnNotFound if there is no such field.
+func (i *Index) setKeyColumn() error {
+	if i.keyColumnName == "" {
+		return nil
+	}
+	for n, name := range i.HeaderFields {
+		if name == i.keyColumnName {
+			i.KeyColumn = n
+			return nil
+		}
+	}
+	return ErrKeyColumnNotFound
+}
+
+// lineKey returns the key portion of line i.e. the KeyColumn field (by
+// default the first), up to the following delimiter (or for composite keys,
+// up to the delimiter following KeyFields fields), or the rest of the line,
+// if there is no such delimiter. If line has no KeyColumn field, the key
+// is empty. With a Dialect, key fields are unquoted (see splitField), and
+// with WholeLine, the key is the whole line. With a FixedWidth layout, the
+// key is at a fixed position, and trimmed of trailing padding.
+func (i *Index) lineKey(line []byte) []byte {
+	if i.WholeLine {
+		return line
+	}
+	if i.FixedWidth != nil {
+		return i.FixedWidth.key(line)
+	}
+	if i.Dialect != nil {
+		return i.quotedLineKey(line)
+	}
+
+	// Skip any fields preceding the key column
+	for n := 0; n < i.KeyColumn; n++ {
+		d := bytes.Index(line, i.Delimiter)
+		if d == -1 {
+			return line[:0]
+		}
+		line = line[d+len(i.Delimiter):]
+	}
+
+	end := -len(i.Delimiter)
+	for n := 0; n < i.KeyFields || n == 0; n++ {
+		start := end + len(i.Delimiter)
+		d := bytes.Index(line[start:], i.Delimiter)
+		if d == -1 {
+			return line
+		}
+		end = start + d
+	}
+	return line[:end]
+}
+
+// keyCompare compares the line key k with the search key q, returning 0 if
+// k matches q, -1 if k sorts before any keys matching q, and +1 if k sorts
+// after them. For composite keys (KeyFields > 1), q may also be a leading
+// subset of the key fields, matching any k that begins with q followed by
+// a delimiter.
+func (i *Index) keyCompare(k, q []byte) int {
+	cmp := i.compare(k, q)
+	if cmp <= 0 || i.KeyFields <= 1 {
+		return cmp
+	}
+	// k > q, so k can only match if it begins with q
+	if !i.hasPrefix(k, q) {
+		return 1
+	}
+	rest := k[len(q):]
+	if bytes.HasPrefix(rest, i.Delimiter) {
+		return 0
+	}
+	// Keys between q and q+delimiter (e.g. "foo!" for "foo") precede matches
+	return i.compare(rest, i.Delimiter)
+}
+
+// uniqueKey returns true if at most one line can match the search key q
+// i.e. keys are unique, and q is a whole key rather than a leading subset
+// of composite key fields (which may match many unique keys).
+func (i *Index) uniqueKey(q []byte) bool {
+	if !i.KeysUnique {
+		return false
+	}
+	if i.KeyFields <= 1 {
+		return true
+	}
+	// Quoted fields may contain delimiters, so q's fields can't be counted
+	return i.Dialect == nil && bytes.Count(q, i.Delimiter) >= i.KeyFields-1
+}
+
+// Compare compares keys a and b using the index Comparator, returning 0 if
+// a == b, -1 if a < b, and +1 if a > b (see Comparator).
+func (i *Index) Compare(a, b []byte) int {
+	return i.compare(a, b)
+}
+
+// compare compares keys a and b using the index Comparator
+func (i *Index) compare(a, b []byte) int {
+	if i.comparator == nil {
+		return bytes.Compare(a, b)
+	}
+	return i.comparator.Compare(a, b)
+}
+
+// compareEntry compares the index entry key k with key using the index
+// Comparator
+func (i *Index) compareEntry(k string, key []byte) int {
+	if i.comparator == nil {
+		// Nb. string(key) conversions are done inline in comparisons,
+		// where they don't allocate
+		switch {
+		case k < string(key):
+			return -1
+		case k > string(key):
+			return 1
+		}
+		return 0
+	}
+	return i.comparator.Compare([]byte(k), key)
+}
+
+// hasPrefix returns true if key k begins with prefix, using the index
+// Comparator (so e.g. with CaseFold, "ALSTOM.COM" begins with "alstom.c")
+func (i *Index) hasPrefix(k, prefix []byte) bool {
+	if i.comparator == nil {
+		return bytes.HasPrefix(k, prefix)
+	}
+	return len(k) >= len(prefix) && i.comparator.Compare(k[:len(prefix)], prefix) == 0
+}
+
+// commonPrefix returns the length of the longest common prefix of keys a
+// and b, compared rune by rune using the index Comparator (so e.g. with
+// CaseFold, "ALSTOM.COM" and "alstom.company" share a 10-byte prefix)
+func (i *Index) commonPrefix(a, b []byte) int {
+	c := 0
+	if i.comparator == nil {
+		for c < len(a) && c < len(b) && a[c] == b[c] {
+			c++
+		}
+		return c
+	}
+	for c < len(a) && c < len(b) {
+		_, n := utf8.DecodeRune(b[c:])
+		if c+n > len(a) || i.comparator.Compare(a[c:c+n], b[c:c+n]) != 0 {
+			break
+		}
+		c += n
+	}
+	return c
+}
+
+// lineField returns field n (0-based) of line, or nil if line has fewer
+// than n+1 fields.
+func (i *Index) lineField(line []byte, n int) []byte {
+	if i.WholeLine {
+		if n > 0 {
+			return nil
+		}
+		return line
+	}
+	if i.FixedWidth != nil {
+		return i.FixedWidth.column(line, n)
+	}
+	if i.Dialect != nil {
+		return i.quotedLineField(line, n)
+	}
+	for ; n > 0; n-- {
+		d := bytes.Index(line, i.Delimiter)
+		if d == -1 {
+			return nil
+		}
+		line = line[d+len(i.Delimiter):]
+	}
+	if d := bytes.Index(line, i.Delimiter); d > -1 {
+		return line[:d]
+	}
+	return line
+}
+
 // blockEntryLE does a binary search on the block entries in the index
 // List and returns the last entry with a Key less-than-or-equal-to key,
 // and its position in the List.
 // If no matching entry is found (i.e. the first index entry Key is
 // greater than key), returns ErrNotFound.
 func (i *Index) blockEntryLE(key []byte) (int, IndexEntry, error) {
-	keystr := string(key)
-	if i.List[0].Key > keystr { // index List cannot be empty
+	if i.compareEntry(i.List[0].Key, key) > 0 { // index List cannot be empty
 		return 0, IndexEntry{}, ErrNotFound
 	}
 
@@ -434,10 +831,9 @@ func (i *Index) blockEntryLE(key []byte) (int, IndexEntry, error) {
 		//fmt.Fprintf(os.Stderr, "+ %s: begin %d, end %d, mid %d\n",
 		// string(b), begin, end, mid)
 
-		cmp := strings.Compare(list[mid].Key, keystr)
-		//fmt.Fprintf(os.Stderr, "+ %s: [%d] comparing vs. %q, cmp %d\n",
-		// string(b), mid, list[mid].Key, cmp)
-		if cmp <= 0 {
+		//fmt.Fprintf(os.Stderr, "+ %s: [%d] comparing vs. %q\n",
+		// string(b), mid, list[mid].Key)
+		if i.compareEntry(list[mid].Key, key) <= 0 {
 			begin = mid
 		} else {
 			if end == mid {
@@ -477,7 +873,12 @@ func (i *Index) blockEntryLT(key []byte) (int, IndexEntry) {
 		}
 		//fmt.Fprintf(os.Stderr, "+ %s: begin %d, end %d, mid %d\n", string(b), begin, end, mid)
 
-		cmp := prefixCompare([]byte(list[mid].Key), key)
+		var cmp int
+		if i.comparator == nil {
+			cmp = prefixCompare([]byte(list[mid].Key), key)
+		} else {
+			cmp = i.compareEntry(list[mid].Key, key)
+		}
 		//fmt.Fprintf(os.Stderr, "+ %s: [%d] comparing vs. %q, cmp %d\n", string(b), mid, list[mid].Key, cmp)
 		if cmp == -1 {
 			begin = mid
@@ -492,6 +893,33 @@ func (i *Index) blockEntryLT(key []byte) (int, IndexEntry) {
 	return begin, list[begin]
 }
 
+// blockEntryFrom returns the position in the index List of the block from
+// which a forward scan for key should begin, like blockEntryLE (or
+// blockEntryLT, if !KeysIndexFirst), but only considering entries from
+// position e onwards (it returns e if no later entry qualifies).
+func (i *Index) blockEntryFrom(key []byte, e int) int {
+	list := i.List[e+1:]
+	n := sort.Search(len(list), func(j int) bool {
+		if i.KeysIndexFirst {
+			return i.compareEntry(list[j].Key, key) > 0
+		}
+		return i.compareEntry(list[j].Key, key) >= 0
+	})
+	return e + n
+}
+
+// blockEntryAt returns the position in the index List of the block
+// containing offset (or 0, if offset precedes the first block).
+func (i *Index) blockEntryAt(offset int64) int {
+	e := sort.Search(len(i.List), func(j int) bool {
+		return i.List[j].Offset > offset
+	})
+	if e == 0 {
+		return 0
+	}
+	return e - 1
+}
+
 // blockEntryN returns the nth IndexEntry in index.List, and an ok flag,
 // which is false if no Nth entry exists.
 func (i *Index) blockEntryN(n int) (IndexEntry, bool) {
@@ -535,13 +963,27 @@ func (i *Index) Write() error {
 	}
 
 	for _, entry := range i.List {
-		record := fmt.Sprintf(
-			"%d%c%s%c",
-			entry.Offset,
-			fieldSeparator,
-			strconv.Quote(entry.Key),
-			recordSeparator,
-		)
+		// Pre-version 5 indices (which we may have loaded) lack line counts
+		var record string
+		if i.Version >= 5 {
+			record = fmt.Sprintf(
+				"%d%c%d%c%s%c",
+				entry.Offset,
+				fieldSeparator,
+				entry.Lines,
+				fieldSeparator,
+				strconv.Quote(entry.Key),
+				recordSeparator,
+			)
+		} else {
+			record = fmt.Sprintf(
+				"%d%c%s%c",
+				entry.Offset,
+				fieldSeparator,
+				strconv.Quote(entry.Key),
+				recordSeparator,
+			)
+		}
 		_, err = writer.WriteString(record)
 		if err != nil {
 			abort()
@@ -1,6 +1,9 @@
 package bsearch
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -216,6 +219,48 @@ func TestNewIndexOptions(t *testing.T) {
 	}
 }
 
+// Test index block line counts, using small blocksizes to exercise blocks
+// beginning with repeated keys
+func TestIndexLineCounts(t *testing.T) {
+	var tests = []struct {
+		filename  string
+		blocksize int
+		lines     int
+	}{
+		{"alstom3.csv", 0, 442},
+		{"alstom3.csv", 256, 442},
+		{"foo.csv", 0, 10000},
+		{"foo.csv", 512, 10000},
+		{"rdns1.csv", 0, 3515},
+		{"rdns1.csv", 256, 3515},
+	}
+
+	for _, tc := range tests {
+		path := filepath.Join("testdata", tc.filename)
+		idx, err := NewIndexOptions(path, IndexOptions{Blocksize: tc.blocksize})
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.filename, err.Error())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total := 0
+		for e, entry := range idx.List {
+			end := len(data)
+			if e+1 < len(idx.List) {
+				end = int(idx.List[e+1].Offset)
+			}
+			expect := strings.Count(string(data[entry.Offset:end]), "\n")
+			assert.Equal(t, expect, entry.Lines,
+				fmt.Sprintf("%s/%d block %d line count", tc.filename, tc.blocksize, e))
+			total += entry.Lines
+		}
+		assert.Equal(t, tc.lines, total, tc.filename+" total lines")
+	}
+}
+
 // Test blockEntryLE() on rir_clc_ipv_range.csv
 func TestIndexBlockEntryLE(t *testing.T) {
 	var tests = []struct {
@@ -255,3 +300,68 @@ func TestIndexBlockEntryLE(t *testing.T) {
 		assert.Equal(t, tc.entryOffset, entry.Offset, tc.key+" entryOffset")
 	}
 }
+
+// Test single rune and multi-rune delimiters
+func TestIndexDelimiters(t *testing.T) {
+	var tests = []struct {
+		filename string
+		delim    string
+	}{
+		{"unitsep.txt", "\x1f"},
+		{"thorn.txt", "þ"},
+		{"colons.txt", "::"},
+		{"thorn_latin1.dat", "\xfe"},
+	}
+
+	for _, tc := range tests {
+		writeIndexOptions(t, tc.filename,
+			IndexOptions{Delimiter: []byte(tc.delim), Header: true})
+		idx, err := LoadIndex(filepath.Join("testdata", tc.filename))
+		if err != nil {
+			t.Fatalf("%s: %s\n", tc.filename, err.Error())
+		}
+		assert.Equal(t, indexVersion, idx.Version, tc.filename+" version")
+		assert.Equal(t, tc.delim, string(idx.Delimiter), tc.filename+" delimiter")
+		assert.Equal(t, []string{"name", "city", "n"}, idx.HeaderFields, tc.filename+" headerFields")
+
+		db, err := NewDB(filepath.Join("testdata", tc.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.GetSlice("Zed")
+		assert.Nil(t, err, tc.filename)
+		assert.Equal(t, []string{"York, UK", "3"}, got, tc.filename+" GetSlice")
+		got, err = db.GetSlice("Bob")
+		assert.Nil(t, err, tc.filename)
+		assert.Equal(t, []string{"Leeds", "2"}, got, tc.filename+" GetSlice")
+		db.Close()
+	}
+
+	for _, delim := range []string{"\n", ",\n"} {
+		_, err := NewIndexOptions("testdata/unitsep.txt",
+			IndexOptions{Delimiter: []byte(delim)})
+		assert.Equal(t, ErrBadDelimiter, err, fmt.Sprintf("%q", delim))
+	}
+
+	// Older index versions encode delimiters as base64, and newer ones
+	// as strings, or byte arrays if they're not valid UTF-8
+	for _, tc := range []struct {
+		delim   string
+		version int
+		encoded string
+	}{
+		{"\x1f", 5, `"Delimiter":"Hw=="`},
+		{"\x1f", indexVersion, `"Delimiter":"\u001f"`},
+		{"\xfe", 5, `"Delimiter":"/g=="`},
+		{"\xfe", indexVersion, `"Delimiter":[254]`},
+	} {
+		idx := Index{Delimiter: []byte(tc.delim), Version: tc.version}
+		data, err := json.Marshal(idx)
+		assert.Nil(t, err)
+		assert.Equal(t, true, bytes.Contains(data, []byte(tc.encoded)), string(data))
+		var idx2 Index
+		err = json.Unmarshal(data, &idx2)
+		assert.Nil(t, err)
+		assert.Equal(t, idx.Delimiter, idx2.Delimiter, string(data))
+	}
+}
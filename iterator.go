@@ -0,0 +1,173 @@
+/*
+Iterator provides forward iteration over a sequence of lines from
+a bsearch.Searcher, such as the key range returned by Searcher.Range.
+*/
+
+package bsearch
+
+// RangeOptions struct for use with Searcher.RangeOptions
+type RangeOptions struct {
+	StartExclusive bool // exclude lines with keys equal to start
+	EndInclusive   bool // include lines with keys equal to end
+}
+
+// Iterator walks forward over the lines of a Searcher's dataset.
+// Typical usage:
+//
+//	it := bss.Range(start, end)
+//	defer it.Close()
+//	for it.Next() {
+//	    line := it.Line()
+//	    ...
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type Iterator struct {
+	s            *Searcher
+	offset       int64  // offset of the next line
+	end          []byte // upper bound key (nil if unbounded)
+	endInclusive bool   // include lines with keys equal to end
+	line         []byte // current line
+	key          []byte // current key
+	err          error
+}
+
+// Range returns an Iterator over all lines in the reader with keys
+// greater-than-or-equal-to start and less-than end, using a binary search
+// to find the first line (data must be ordered by the index Comparator). A
+// nil start begins with the first line in the dataset, and a nil end
+// continues to the end of the dataset.
+func (s *Searcher) Range(start, end []byte) *Iterator {
+	return s.RangeOptions(start, end, RangeOptions{})
+}
+
+// RangeOptions returns an Iterator over all lines in the reader with keys
+// between start and end, using opt to control whether the bounds are
+// inclusive or exclusive (by default start is inclusive and end exclusive).
+func (s *Searcher) RangeOptions(start, end []byte, opt RangeOptions) *Iterator {
+	it := &Iterator{
+		s:            s,
+		end:          end,
+		endInclusive: opt.EndInclusive,
+	}
+
+	err := s.checkIndex()
+	if err != nil {
+		it.err = err
+		return it
+	}
+	start, it.end = s.searchKey(start), s.searchKey(end)
+
+	if start == nil {
+		it.offset = s.Index.List[0].Offset
+	} else {
+		it.offset = s.seekOffset(start, opt.StartExclusive)
+	}
+	return it
+}
+
+// CountRange returns the number of lines in the reader with keys
+// greater-than-or-equal-to start and less-than end (with nil start or end
+// being unbounded, as for Range), without copying them.
+func (s *Searcher) CountRange(start, end []byte) (int, error) {
+	return s.CountRangeOptions(start, end, RangeOptions{})
+}
+
+// CountRangeOptions returns the number of lines in the reader with keys
+// between start and end, using opt to control whether the bounds are
+// inclusive or exclusive (as for RangeOptions). The index block line counts
+// are used to count the lines between the bounds, so only the lines in the
+// blocks containing the bounds themselves are counted individually.
+func (s *Searcher) CountRangeOptions(start, end []byte, opt RangeOptions) (int, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return 0, err
+	}
+	start, end = s.searchKey(start), s.searchKey(end)
+
+	startOffset := s.dataOffset()
+	if start != nil {
+		startOffset = s.seekOffset(start, opt.StartExclusive)
+	}
+	endOffset := s.l
+	if end != nil {
+		endOffset = s.seekOffset(end, opt.EndInclusive)
+	}
+	if endOffset <= startOffset {
+		return 0, nil
+	}
+
+	return s.rankAt(endOffset) - s.rankAt(startOffset), nil
+}
+
+// Count returns the number of lines in the reader with key, without copying
+// them (data must be ordered by the index Comparator).
+func (s *Searcher) Count(key []byte) (int, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return 0, err
+	}
+	// Lines matching a composite key may be interleaved with others (see
+	// Index.keyCompare), so those must be counted individually
+	if s.Index.KeyFields > 1 {
+		count := 0
+		err = s.scanIndexedLines(s.searchKey(key), func(int64, []byte) bool {
+			count++
+			return true
+		})
+		if err == ErrNotFound {
+			return 0, nil
+		}
+		return count, err
+	}
+	return s.CountRangeOptions(key, key, RangeOptions{EndInclusive: true})
+}
+
+// Next advances the iterator to the next line, which is then available
+// via Line and Key. It returns false when the iterator is exhausted or an
+// error occurs.
+func (it *Iterator) Next() bool {
+	it.line, it.key = nil, nil
+	if it.err != nil || it.offset >= it.s.l {
+		return false
+	}
+
+	line, next := it.s.lineAt(it.offset)
+	key := it.s.Index.lineKey(line)
+	if it.end != nil {
+		if it.endInclusive && it.s.Index.keyCompare(key, it.end) > 0 ||
+			!it.endInclusive && it.s.Index.compare(key, it.end) >= 0 {
+			it.offset = it.s.l
+			return false
+		}
+	}
+
+	it.line, it.key = line, key
+	it.offset = next
+	return true
+}
+
+// Line returns the current line. The returned slice points directly into
+// the Searcher's data, so it must not be modified, is only valid until
+// the Searcher is closed, and is never reversed.
+func (it *Iterator) Line() []byte {
+	return it.line
+}
+
+// Key returns the key of the current line (subject to the same caveats
+// as Line).
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Err returns the first error encountered by the iterator, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close terminates the iteration, after which Next always returns false.
+func (it *Iterator) Close() {
+	it.offset = it.s.l
+	it.line, it.key = nil, nil
+}
@@ -0,0 +1,193 @@
+package bsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Searcher.Range() using testdata/rdns1.csv (no header, duplicate keys)
+func TestSearcherRange(t *testing.T) {
+	var tests = []struct {
+		start      string
+		end        string
+		opt        RangeOptions
+		count      int
+		first_line string
+		last_line  string
+	}{
+		{"001.034.164.000", "001.079.088.000", RangeOptions{}, 3,
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net",
+			"001.065.117.000,1-65-117-000.static.netvigator.com,202003,netvigator.com"},
+		{"001.034.164.000", "001.079.088.000", RangeOptions{StartExclusive: true, EndInclusive: true}, 3,
+			"001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au",
+			"001.079.088.000,sp1-79-88-0.msb.spmode.ne.jp,202003,spmode.ne.jp"},
+		{"001.034", "001.066", RangeOptions{}, 3,
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net",
+			"001.065.117.000,1-65-117-000.static.netvigator.com,202003,netvigator.com"},
+		{"032.176.184.000", "032.176.184.000", RangeOptions{EndInclusive: true}, 6,
+			"032.176.184.000,mobile000.mycingular.net,202003,mycingular.net",
+			"032.176.184.000,mobile005.mycingular.net,202003,mycingular.net"},
+		{"032.176.184.000", "033", RangeOptions{StartExclusive: true}, 4,
+			"032.176.228.000,mobile000.mycingular.net,202003,mycingular.net",
+			"032.179.173.000,mobile002.mycingular.net,202003,mycingular.net"},
+		{"032.176.184.000", "032.176.184.000", RangeOptions{}, 0, "", ""},
+		{"223", "", RangeOptions{}, 7,
+			"223.018.249.000,0-249-18-223-on-nets.com,202003,0-249-18-223-on-nets.com",
+			"223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net"},
+		{"", "001.041", RangeOptions{}, 2,
+			"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net",
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net"},
+		{"", "", RangeOptions{}, 3515,
+			"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net",
+			"223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net"},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		// Use nil for unbounded start/end
+		var start, end []byte
+		if tc.start != "" {
+			start = []byte(tc.start)
+		}
+		if tc.end != "" {
+			end = []byte(tc.end)
+		}
+		label := tc.start + " - " + tc.end
+
+		it := s.RangeOptions(start, end, tc.opt)
+		lines := []string{}
+		for it.Next() {
+			assert.Equal(t, string(it.Line()[:len(it.Key())]), string(it.Key()),
+				label+" key")
+			lines = append(lines, string(it.Line()))
+		}
+		assert.Nil(t, it.Err(), label+" err")
+		it.Close()
+
+		assert.Equal(t, tc.count, len(lines), label+" line count")
+		if len(lines) > 0 {
+			assert.Equal(t, tc.first_line, lines[0], label+" first_line")
+			assert.Equal(t, tc.last_line, lines[len(lines)-1], label+" last_line")
+		}
+	}
+}
+
+// Test Searcher.Range() using testdata/foo.csv (header, multiple blocks)
+func TestSearcherRangeFoo(t *testing.T) {
+	ensureIndex(t, "foo.csv")
+	s, err := NewSearcher("testdata/foo.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	it := s.Range(nil, []byte("foo"))
+	assert.True(t, it.Next())
+	assert.Equal(t, "bar,1", string(it.Line()))
+	assert.Equal(t, "bar", string(it.Key()))
+	assert.False(t, it.Next())
+	assert.Nil(t, it.Line())
+
+	count := 0
+	it = s.Range([]byte("c"), nil)
+	for it.Next() {
+		count++
+		if count == 10 {
+			it.Close()
+		}
+	}
+	assert.Equal(t, 10, count, "iteration stops after Close")
+}
+
+// Test Searcher.Count() and Searcher.CountRange() against Range iteration
+func TestSearcherCount(t *testing.T) {
+	var tests = []struct {
+		filename string
+		key      string
+		count    int
+	}{
+		{"foo.csv", "bar", 1},
+		{"foo.csv", "baz", 0},
+		{"foo.csv", "foo", 9999},
+		{"rdns1.csv", "032.176.184.000", 6},
+		{"rdns1.csv", "032.176.184", 0},
+		{"rdns1.csv", "223.252.003.000", 1},
+		{"alstom3.csv", "alstom.com", 438},
+		{"alstom3.csv", "alstom.com.br", 1},
+	}
+
+	for _, tc := range tests {
+		ensureIndex(t, tc.filename)
+		s, err := NewSearcher("testdata/" + tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		count, err := s.Count([]byte(tc.key))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.count, count, tc.filename+" "+tc.key)
+	}
+
+	var rangeTests = []struct {
+		filename string
+		start    string
+		end      string
+	}{
+		{"rdns1.csv", "", ""},
+		{"rdns1.csv", "001", "100"},
+		{"rdns1.csv", "032.176.184.000", "032.176.184.000"},
+		{"rdns1.csv", "100", ""},
+		{"rdns1.csv", "", "223.252.003.000"},
+		{"alstom3.csv", "", ""},
+		{"alstom3.csv", "alstom.co", "alstom.com.br"},
+		{"foo.csv", "", "foo"},
+	}
+	opts := []RangeOptions{
+		{},
+		{StartExclusive: true},
+		{EndInclusive: true},
+	}
+
+	for _, tc := range rangeTests {
+		s, err := NewSearcher("testdata/" + tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		var start, end []byte
+		if tc.start != "" {
+			start = []byte(tc.start)
+		}
+		if tc.end != "" {
+			end = []byte(tc.end)
+		}
+		for _, opt := range opts {
+			expect := 0
+			it := s.RangeOptions(start, end, opt)
+			for it.Next() {
+				expect++
+			}
+			count, err := s.CountRangeOptions(start, end, opt)
+			assert.Nil(t, err)
+			assert.Equal(t, expect, count, tc.filename+" "+tc.start+" - "+tc.end)
+		}
+	}
+
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	count, err := s.CountRange(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3515, count, "rdns1.csv total")
+}
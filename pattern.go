@@ -0,0 +1,157 @@
+package bsearch
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Glob returns all lines in the reader whose keys match the shell glob
+// pattern, where '*' matches any sequence of characters, '?' matches any
+// single character, '[...]' matches a character class (negated with
+// '[!...]'), and '\' matches the following character literally.
+//
+// The literal prefix of pattern (everything before the first wildcard) is
+// used to binary search to the first candidate line (data must be ordered
+// by the index Comparator), so only lines with keys beginning with that
+// prefix are checked e.g. `alstom.c*` only checks keys beginning with
+// "alstom.c". Patterns are matched against keys as stored in the dataset
+// (i.e. they are not reversed for KeysReversed datasets).
+func (s *Searcher) Glob(pattern []byte) ([][]byte, error) {
+	re, err := globRegexp(string(pattern))
+	if err != nil {
+		return [][]byte{}, err
+	}
+	return s.scanPattern(regexpPrefix(re), func(line []byte) bool {
+		return re.Match(s.Index.lineKey(line))
+	})
+}
+
+// Regexp returns all lines in the reader matching re. If re is anchored to
+// the start of the line (e.g. `^001\.034\.`), its literal prefix is used to
+// binary search to the first candidate line (data must be ordered by the
+// index Comparator), so only lines beginning with that prefix are checked.
+// Otherwise (or if the key is not the first column, or may be quoted, or is
+// not at the start of fixed-width records) every line in the dataset must
+// be checked (like grep). re is matched against lines as stored in the
+// dataset (i.e. they are not reversed for KeysReversed datasets).
+func (s *Searcher) Regexp(re *regexp.Regexp) ([][]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return [][]byte{}, err
+	}
+	// Lines are only ordered by key, so we can only use the key portion
+	// of the line prefix, and only if the key is the first (unquoted)
+	// column
+	var prefix []byte
+	if s.Index.KeyColumn == 0 && s.Index.Dialect == nil &&
+		(s.Index.FixedWidth == nil || s.Index.FixedWidth.KeyOffset == 0) {
+		prefix = s.Index.lineKey(regexpPrefix(re))
+	}
+	return s.scanPattern(prefix, re.Match)
+}
+
+// scanPattern returns copies of all lines with keys beginning with prefix
+// for which match returns true, or ErrNotFound if there are none.
+func (s *Searcher) scanPattern(prefix []byte, match func(line []byte) bool) ([][]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return [][]byte{}, err
+	}
+
+	offset := s.dataOffset()
+	if len(prefix) > 0 {
+		offset = s.seekPrefix(prefix)
+	}
+
+	var lines [][]byte
+	for offset < s.l {
+		line, next := s.lineAt(offset)
+		if !s.Index.hasPrefix(s.Index.lineKey(line), prefix) {
+			break
+		}
+		if match(line) {
+			lines = append(lines, s.copyLine(line))
+		}
+		offset = next
+	}
+
+	if len(lines) == 0 {
+		return lines, ErrNotFound
+	}
+	return lines, nil
+}
+
+// globRegexp returns the anchored regexp equivalent to the glob pattern
+// (see Glob), or ErrBadPattern if pattern is malformed.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '\\':
+			i++
+			if i == len(pattern) {
+				return nil, ErrBadPattern
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			// Find the closing ']' (which may be the first class character)
+			j := i + 1
+			if j < len(pattern) && (pattern[j] == '!' || pattern[j] == '^') {
+				j++
+			}
+			if j < len(pattern) && pattern[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(pattern[j:], ']')
+			if end == -1 {
+				return nil, ErrBadPattern
+			}
+			class := pattern[i+1 : j+end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = j + end
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString(`$`)
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, ErrBadPattern
+	}
+	return re, nil
+}
+
+// regexpPrefix returns the literal prefix that any match of re must begin
+// with if re is anchored to the start of the text, and nil otherwise.
+// (regexp.LiteralPrefix ignores anchoring, and gives up on patterns
+// like `^abc.*x$`, so we use the parsed syntax tree instead.)
+func regexpPrefix(re *regexp.Regexp) []byte {
+	p, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	p = p.Simplify()
+	if p.Op != syntax.OpConcat || len(p.Sub) == 0 ||
+		(p.Sub[0].Op != syntax.OpBeginText && p.Sub[0].Op != syntax.OpBeginLine) {
+		return nil
+	}
+
+	var prefix []byte
+	for _, sub := range p.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix = append(prefix, string(sub.Rune)...)
+	}
+	return prefix
+}
@@ -0,0 +1,118 @@
+package bsearch
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Searcher.Glob() using testdata/alstom1.csv
+func TestSearcherGlob(t *testing.T) {
+	var tests = []struct {
+		pattern    string
+		count      int
+		first_line string
+		last_line  string
+	}{
+		{"alstom.c*", 6, "alstom.ca,alstom.com,RED", "alstom.com.br,alstom.com,RED"},
+		{"alstom.c?", 1, "alstom.ca,alstom.com,RED", "alstom.ca,alstom.com,RED"},
+		{"alstom.com.[ab]*", 2, "alstom.com.au,alstom.com,RED", "alstom.com.br,alstom.com,RED"},
+		{"alstom.co[!m]*", 1, "alstom.co.th,alstom.com,RED", "alstom.co.th,alstom.com,RED"},
+		{"*.com", 3, "alstom.com,alstom.com,SOA", "alt.com,alt.com,SOA"},
+		{"alstom\\.com", 2, "alstom.com,alstom.com,SOA", "alstom.com,alstom.com,ULT"},
+		{"alstom.c", 0, "", ""},
+		{"alstom.d*", 0, "", ""},
+	}
+
+	ensureIndex(t, "alstom1.csv")
+	s, err := NewSearcher("testdata/alstom1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		lines, err := s.Glob([]byte(tc.pattern))
+		if tc.count == 0 {
+			assert.Equal(t, ErrNotFound, err, tc.pattern+" returns ErrNotFound")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.count, len(lines), tc.pattern+" line count")
+		if len(lines) > 0 {
+			assert.Equal(t, tc.first_line, string(lines[0]), tc.pattern+" first_line")
+			assert.Equal(t, tc.last_line, string(lines[len(lines)-1]),
+				tc.pattern+" last_line")
+		}
+	}
+
+	_, err = s.Glob([]byte("alstom.[c"))
+	assert.Equal(t, ErrBadPattern, err)
+}
+
+// Test Searcher.Regexp() using testdata/rdns1.csv
+func TestSearcherRegexp(t *testing.T) {
+	var tests = []struct {
+		re         string
+		count      int
+		first_line string
+		last_line  string
+	}{
+		{`^001\.034\.`, 1,
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net",
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net"},
+		{`^032\.176\.184\.000,mobile00[0-2]\.`, 3,
+			"032.176.184.000,mobile000.mycingular.net,202003,mycingular.net",
+			"032.176.184.000,mobile002.mycingular.net,202003,mycingular.net"},
+		{`^001\..*\.au$`, 2,
+			"001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au",
+			"001.123.104.000,cpe-1-223-104-0.bpi3-r-032.fli.sa.bigpond.net.au,202003,bigpond.net.au"},
+		{`HINET`, 13,
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net",
+			"220.132.254.000,220-132-254-0.HINET-IP.hinet.net,202003,hinet.net"},
+		{`^001\.034\.164\.001`, 0, "", ""},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		lines, err := s.Regexp(regexp.MustCompile(tc.re))
+		if tc.count == 0 {
+			assert.Equal(t, ErrNotFound, err, tc.re+" returns ErrNotFound")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.count, len(lines), tc.re+" line count")
+		if len(lines) > 0 {
+			assert.Equal(t, tc.first_line, string(lines[0]), tc.re+" first_line")
+			assert.Equal(t, tc.last_line, string(lines[len(lines)-1]),
+				tc.re+" last_line")
+		}
+	}
+}
+
+func TestRegexpPrefix(t *testing.T) {
+	var tests = []struct {
+		re     string
+		expect string
+	}{
+		{`^001\.034\.`, "001.034."},
+		{`^abc.*x$`, "abc"},
+		{`^abc?`, "ab"},
+		{`^ab|^ac`, ""},
+		{`(?i)^abc`, ""},
+		{`abc`, ""},
+		{`(?s)^alstom\.c.*$`, "alstom.c"},
+	}
+
+	for _, tc := range tests {
+		got := regexpPrefix(regexp.MustCompile(tc.re))
+		assert.Equal(t, tc.expect, string(got), tc.re)
+	}
+}
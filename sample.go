@@ -0,0 +1,68 @@
+package bsearch
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Sample returns n data lines chosen uniformly at random (without
+// replacement) from the reader, skipping any header. The index block line
+// counts are used to jump directly to the blocks containing the chosen
+// lines, so only those blocks are read, rather than the whole file.
+// Lines are returned in dataset order. If n is greater than the number of
+// data lines, all of them are returned. rng is the source of randomness
+// (if nil, the math/rand top-level functions are used instead).
+func (s *Searcher) Sample(n int, rng *rand.Rand) ([][]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return [][]byte{}, err
+	}
+
+	ranks := s.blockRanks()
+	total := ranks[len(ranks)-1]
+	if n > total {
+		n = total
+	}
+	if n <= 0 {
+		return [][]byte{}, nil
+	}
+	intn := rand.Intn
+	if rng != nil {
+		intn = rng.Intn
+	}
+
+	// Choose n distinct line numbers using Floyd's algorithm
+	chosen := make(map[int]bool, n)
+	for j := total - n; j < total; j++ {
+		t := intn(j + 1)
+		if chosen[t] {
+			t = j
+		}
+		chosen[t] = true
+	}
+	nums := make([]int, 0, n)
+	for i := range chosen {
+		nums = append(nums, i)
+	}
+	sort.Ints(nums)
+
+	// Fetch chosen lines in a single forward pass, jumping ahead to the
+	// next chosen line's block whenever it's beyond the current one
+	lines := make([][]byte, 0, n)
+	e, rank, offset := 0, 0, s.dataOffset()
+	for _, i := range nums {
+		if i >= ranks[e+1] {
+			e = sort.Search(len(ranks), func(j int) bool { return ranks[j] > i }) - 1
+			if ranks[e] > rank {
+				rank, offset = ranks[e], s.Index.List[e].Offset
+			}
+		}
+		for ; rank < i; rank++ {
+			_, offset = s.lineAt(offset)
+		}
+		line, _ := s.lineAt(offset)
+		lines = append(lines, s.copyLine(line))
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,89 @@
+package bsearch
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Searcher.Sample() using testdata/rdns1.csv
+func TestSearcherSample(t *testing.T) {
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	lines, err := s.Sample(100, rand.New(rand.NewSource(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(lines))
+
+	// Lines should be distinct dataset lines, in dataset order
+	for i, line := range lines {
+		if i > 0 {
+			assert.Equal(t, -1, bytes.Compare(lines[i-1], line), "lines are ordered")
+		}
+		found := false
+		err = s.Each(s.Index.lineKey(line), func(l []byte) bool {
+			found = bytes.Equal(l, line)
+			return !found
+		})
+		assert.Nil(t, err)
+		assert.True(t, found, string(line))
+	}
+
+	// The same seed should give the same sample
+	lines2, err := s.Sample(100, rand.New(rand.NewSource(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, lines, lines2)
+
+	lines, err = s.Sample(0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lines))
+}
+
+// Test Searcher.Sample() returns all data lines (without the header) when
+// n exceeds the number of lines, using testdata/alstom3.csv
+func TestSearcherSampleAll(t *testing.T) {
+	ensureIndex(t, "alstom3.csv")
+	s, err := NewSearcher("testdata/alstom3.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	lines, err := s.Sample(1000, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 442, len(lines))
+	assert.Equal(t, "alstom.ca,first", string(lines[0]))
+	assert.Equal(t, "alstom.com.br,first", string(lines[len(lines)-1]))
+}
+
+// Test Searcher.Sample() is (roughly) uniform, using testdata/alstom1.csv
+func TestSearcherSampleUniform(t *testing.T) {
+	ensureIndex(t, "alstom1.csv")
+	s, err := NewSearcher("testdata/alstom1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Sample 3 of 7 lines 7000 times, so each line should be chosen
+	// around 3000 times
+	rng := rand.New(rand.NewSource(42))
+	counts := make(map[string]int)
+	for i := 0; i < 7000; i++ {
+		lines, err := s.Sample(3, rng)
+		assert.Nil(t, err)
+		for _, line := range lines {
+			counts[string(line)]++
+		}
+	}
+	assert.Equal(t, 7, len(counts))
+	for line, count := range counts {
+		assert.InDelta(t, 3000, count, 300, line)
+	}
+}
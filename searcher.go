@@ -2,8 +2,8 @@
 bsearch provides binary search functionality for line-ordered byte streams
 by prefix (e.g. for searching `LC_ALL=C` sorted text files).
 
-TODO: can we change the comparison function to support UTF-8 ordered keys?
-      e.g. BytesEqual, StringEqual, BytesLessEqual, StringLessEqual
+Keys are compared bytewise by default, but other orderings (e.g. case-folded,
+or Unicode collation) may be selected via IndexOptions.Comparator.
 */
 
 package bsearch
@@ -15,6 +15,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
 	"launchpad.net/gommap"
@@ -27,29 +30,45 @@ var (
 	ErrNotFound            = errors.New("key not found")
 	ErrKeyExceedsBlocksize = errors.New("key length exceeds blocksize")
 	ErrUnknownDelimiter    = errors.New("cannot guess delimiter from filename")
+	ErrBadPattern          = errors.New("syntax error in glob pattern")
 
 	reCompressedUnsupported = regexp.MustCompile(`\.(zst|gz|bz2|xz|zip)$`)
 )
 
 // SearcherOptions struct for use with NewSearcherOptions
 type SearcherOptions struct {
-	MatchLE bool            // use less-than-or-equal-to match semantics
-	Logger  *zerolog.Logger // debug logger
+	MatchLE      bool            // use less-than-or-equal-to match semantics
+	LineNumbers  bool            // set Match.LineNumber on Matches (requires counting lines)
+	ReverseLines bool            // reverse lines returned from KeysReversed datasets (zero-copy methods excepted)
+	IntervalEnd  int             // interval mode: (0-based) field number of interval end keys (see Lines)
+	Logger       *zerolog.Logger // debug logger
 	// Index options (used to check index or build new one)
-	Delimiter []byte // delimiter separating fields in dataset
-	Header    bool   // first line of dataset is header and should be ignored
+	Delimiter     []byte      // delimiter separating fields in dataset
+	Header        bool        // first line of dataset is header and should be ignored
+	KeyColumn     int         // (0-based) field number of the key column the index must use
+	KeyColumnName string      // header field name of the key column the index must use
+	Dialect       *Dialect    // field quoting rules the index must use
+	WholeLine     bool        // lines are keys, with no fields, which the index must use
+	FixedWidth    *FixedWidth // fixed-width layout the index must use
 }
 
 // Searcher provides binary search functionality on byte-ordered CSV-style
-// delimited text files.
+// delimited text files (or with WholeLine, on plain sorted word lists).
 type Searcher struct {
-	r        io.ReaderAt     // data reader
-	l        int64           // data length
-	mmap     []byte          // data mmap
-	filepath string          // filename path
-	Index    *Index          // bsearch index
-	matchLE  bool            // LinePosition uses less-than-or-equal-to match semantics
-	logger   *zerolog.Logger // debug logger
+	r            io.ReaderAt       // data reader
+	l            int64             // data length
+	mmap         []byte            // data mmap
+	filepath     string            // filename path
+	Index        *Index            // bsearch index
+	matchLE      bool              // Line uses less-than-or-equal-to match semantics
+	lineNumbers  bool              // set Match.LineNumber on Matches
+	reverseLines bool              // reverse lines returned from KeysReversed datasets
+	intervalEnd  int               // interval mode end key field number (0 if not set)
+	secondary    map[int]*Searcher // secondary index searchers by column (see LinesBy)
+	secondaryMu  sync.Mutex        // guards secondary
+	ranks        []int             // cumulative line counts by block (see blockRanks)
+	ranksOnce    sync.Once         // guards ranks
+	logger       *zerolog.Logger   // debug logger
 }
 
 //buf      []byte          // data buffer
@@ -57,11 +76,28 @@ type Searcher struct {
 //dbuf       []byte          // decompressed data buffer
 //dbufOffset int64           // decompressed data buffer offset
 
+// Match describes a line found by a Searcher, and its location.
+type Match struct {
+	Line       []byte // matching line (without trailing newline)
+	Key        []byte // key of Line
+	Offset     int64  // byte offset of Line in the dataset file
+	LineNumber int64  // 1-based line number of Line in the dataset file (only set with the LineNumbers option)
+}
+
 // setOptions sets the given options on searcher
 func (s *Searcher) setOptions(options SearcherOptions) {
 	if options.MatchLE {
 		s.matchLE = true
 	}
+	if options.LineNumbers {
+		s.lineNumbers = true
+	}
+	if options.ReverseLines {
+		s.reverseLines = true
+	}
+	if options.IntervalEnd > 0 {
+		s.intervalEnd = options.IntervalEnd
+	}
 	if options.Logger != nil {
 		s.logger = options.Logger
 	}
@@ -103,6 +139,7 @@ func NewSearcherOptions(path string, opt SearcherOptions) (*Searcher, error) {
 	// Mmap file
 	mmap, err := gommap.Map(rdr.Fd(), gommap.PROT_READ, gommap.MAP_PRIVATE)
 	if err != nil {
+		rdr.Close()
 		return nil, err
 	}
 
@@ -117,73 +154,89 @@ func NewSearcherOptions(path string, opt SearcherOptions) (*Searcher, error) {
 	//dbufOffset: -1,
 	s.setOptions(opt)
 
-	// Load index
+	// Load index, and check it matches opt (releasing the file and mmap
+	// if not)
 	s.Index, err = LoadIndex(path)
+	if err == nil {
+		err = s.checkIndexOptions(opt)
+	}
 	if err != nil {
+		mmap.UnsafeUnmap()
+		rdr.Close()
 		return nil, err
 	}
-	return &s, nil
-}
 
-func getNBytesFrom(buf []byte, length int, delim []byte) []byte {
-	segment := buf[:length]
-
-	// If segment includes a delimiter, truncate it there
-	if d := bytes.Index(segment, delim); d > -1 {
-		return segment[:d]
+	// Ignore any trailing partial record in fixed-length record datasets
+	if rl := s.Index.recordLength(); rl > 0 {
+		s.l -= (s.l - s.dataOffset()) % rl
 	}
 
-	return segment
+	return &s, nil
 }
 
-// scanLinesWithKey returns the first n lines beginning with key from buf.
-func (s *Searcher) scanLinesWithKey(buf, key []byte, n int) [][]byte {
-	// This differs from the old scanLinesMatching in that it assumes
-	// that buf contains *all* lines we might need, rather than just
-	// an initial block.
-	var lines [][]byte
-
-	// Skip lines with a key < ours
-	keyde := append(key, s.Index.Delimiter...)
-	offset := 0
-	for offset < len(buf) {
-		// If buf is out of space, we're done
-		if len(buf)-offset < len(key) {
-			return lines
-		}
-		k := getNBytesFrom(buf[offset:], len(key), s.Index.Delimiter)
-		if bytes.Compare(k, key) > -1 {
-			break
+// checkIndexOptions checks that s.Index uses the key column, dialect,
+// whole-line keys, and fixed-width layout specified in opt (if any).
+func (s *Searcher) checkIndexOptions(opt SearcherOptions) error {
+	if opt.KeyColumnName != "" {
+		col := -1
+		for n, name := range s.Index.HeaderFields {
+			if name == opt.KeyColumnName {
+				col = n
+				break
+			}
 		}
-		nlidx := bytes.IndexByte(buf[offset:], '\n')
-		if nlidx == -1 {
-			// If no new newline is found, there are no more lines to check
-			return lines
+		if col != s.Index.KeyColumn {
+			return ErrIndexKeyColumnMismatch
 		}
-		offset += nlidx + 1
+	} else if opt.KeyColumn > 0 && opt.KeyColumn != s.Index.KeyColumn {
+		return ErrIndexKeyColumnMismatch
 	}
+	if opt.Dialect != nil && !opt.Dialect.equal(s.Index.Dialect) {
+		return ErrIndexDialectMismatch
+	}
+	if opt.WholeLine && !s.Index.WholeLine {
+		return ErrIndexWholeLineMismatch
+	}
+	if opt.FixedWidth != nil && !opt.FixedWidth.equal(s.Index.FixedWidth) {
+		return ErrIndexFixedWidthMismatch
+	}
+	return nil
+}
 
-	// Collate up to n lines beginning with keyde
-	for offset < len(buf) && bytes.HasPrefix(buf[offset:], keyde) {
-		nlidx := bytes.IndexByte(buf[offset:], '\n')
-		if nlidx == -1 {
-			// If no newline found, read to end of buf
-			nlidx = len(buf) - offset
-		}
-		lines = append(lines, clonebs(buf[offset:offset+nlidx]))
-		if n > 0 && len(lines) >= n {
+// scanLinesWithKey calls fn with the offset and contents of each line in
+// s.mmap with key, scanning forward from offset, until fn returns false.
+// Returns the number of lines passed to fn.
+func (s *Searcher) scanLinesWithKey(offset int64, key []byte, fn func(int64, []byte) bool) int {
+	// This differs from the old scanLinesMatching in that it assumes
+	// that s.mmap[offset:] contains *all* lines we might need, rather
+	// than just an initial block.
+	count := 0
+	for offset < s.l {
+		line, next := s.lineAt(offset)
+		cmp := s.Index.keyCompare(s.Index.lineKey(line), key)
+		if cmp > 0 {
 			break
 		}
-		offset += nlidx + 1
+		// Skip lines with a key < ours, and pass on those matching it
+		if cmp == 0 {
+			count++
+			if !fn(offset, line) {
+				break
+			}
+		}
+		offset = next
 	}
-
-	return lines
+	return count
 }
 
-// scanIndexedLines returns the first n lines from reader that begin with key.
-// Returns a slice of byte slices on success.
-func (s *Searcher) scanIndexedLines(key []byte, n int) ([][]byte, error) {
-	var lines [][]byte
+// scanIndexedLines calls fn with the offset and contents of each line in
+// s.mmap with key (or in interval mode, whose interval contains key), until
+// fn returns false. Returns ErrNotFound if no lines match.
+func (s *Searcher) scanIndexedLines(key []byte, fn func(int64, []byte) bool) error {
+	if s.intervalEnd > 0 {
+		return s.scanIntervalLines(key, fn)
+	}
+
 	var entry IndexEntry
 	var e int
 	var err error
@@ -192,7 +245,12 @@ func (s *Searcher) scanIndexedLines(key []byte, n int) ([][]byte, error) {
 		// can use the more efficient less-than-or-equal-to block lookup
 		e, entry, err = s.Index.blockEntryLE(key)
 		if err != nil {
-			return lines, err
+			// Composite keys greater than key may still match it (e.g.
+			// "foo,bar" matches "foo"), so we can only bail if !KeyFields
+			if s.Index.KeyFields <= 1 {
+				return err
+			}
+			e, entry = 0, s.Index.List[0]
 		}
 	} else {
 		e, entry = s.Index.blockEntryLT(key)
@@ -212,16 +270,48 @@ func (s *Searcher) scanIndexedLines(key []byte, n int) ([][]byte, error) {
 			Msg("scanIndexedLines blockEntryXX returned")
 	}
 
-	lines = s.scanLinesWithKey(s.mmap[entry.Offset:], key, n)
-	if len(lines) == 0 {
-		return lines, ErrNotFound
+	if s.scanLinesWithKey(entry.Offset, key, fn) == 0 {
+		return ErrNotFound
 	}
-	return lines, nil
+	return nil
+}
+
+// scanIntervalLines calls fn with the offset and contents of each line in
+// s.mmap whose [start,end] interval contains key (where start is the line
+// key, and end is field s.intervalEnd), until fn returns false. Only the
+// lines with the greatest start key less-than-or-equal-to key are checked,
+// so intervals are assumed not to overlap. Returns ErrNotFound if key falls
+// before the first interval, or into a gap between intervals.
+func (s *Searcher) scanIntervalLines(key []byte, fn func(int64, []byte) bool) error {
+	offset, err := s.floorOffset(key)
+	if err != nil {
+		return err
+	}
+	line, _ := s.lineAt(offset)
+
+	count := 0
+	s.scanLinesWithKey(offset, s.Index.lineKey(line), func(offset int64, line []byte) bool {
+		if s.Index.compare(s.Index.lineField(line, s.intervalEnd), key) < 0 {
+			return true
+		}
+		count++
+		return fn(offset, line)
+	})
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-// Line returns the first line in the reader that begins with key,
-// using a binary search (data must be bytewise-ordered).
+// Line returns the first line in the reader that begins with key, using a
+// binary search (data must be ordered by the index Comparator). If the
+// MatchLE option is set, Line instead returns the first line with the
+// greatest key less-than-or-equal-to key (see Floor). In interval mode,
+// Line returns the first line whose interval contains key (see Lines).
 func (s *Searcher) Line(key []byte) ([]byte, error) {
+	if s.matchLE && s.intervalEnd == 0 {
+		return s.Floor(key)
+	}
 	lines, err := s.LinesN(key, 1)
 	if err != nil || len(lines) < 1 {
 		return []byte{}, err
@@ -229,30 +319,661 @@ func (s *Searcher) Line(key []byte) ([]byte, error) {
 	return lines[0], nil
 }
 
-// Lines returns all lines in the reader that begin with the byte
-// slice b, using a binary search (data must be bytewise-ordered).
+// Lines returns all lines in the reader that begin with the byte slice b,
+// using a binary search (data must be ordered by the index Comparator).
+//
+// If the IntervalEnd option is set, the dataset is instead treated as a
+// table of non-overlapping [start,end] intervals (e.g. "start,end,payload"
+// range tables), and Lines returns the lines whose interval contains b,
+// or ErrNotFound if b falls into a gap between intervals. Line, LinesN,
+// Each, LinePosition and Matches (and DB lookups) behave likewise.
 func (s *Searcher) Lines(b []byte) ([][]byte, error) {
 	return s.LinesN(b, 0)
 }
 
-// LinesN returns the first n lines in the reader that begin with key,
-// using a binary search (data must be bytewise-ordered).
+// LinesN returns the first n lines in the reader that begin with key, using
+// a binary search (data must be ordered by the index Comparator).
 func (s *Searcher) LinesN(key []byte, n int) ([][]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return [][]byte{}, err
+	}
+	key = s.searchKey(key)
+
 	// If keys are unique max(n) is 1
-	if n == 0 && s.Index.KeysUnique {
+	if n == 0 && s.Index.uniqueKey(key) {
 		n = 1
 	}
 
-	// If no index exists, build and use a temporary one (but don't write)
-	if s.Index == nil {
-		index, err := NewIndex(s.filepath)
+	var lines [][]byte
+	err = s.scanIndexedLines(key, func(_ int64, line []byte) bool {
+		lines = append(lines, s.copyLine(line))
+		return n <= 0 || len(lines) < n
+	})
+	return lines, err
+}
+
+// Each calls fn for each line in the reader that begins with key, using a
+// binary search (data must be ordered by the index Comparator), until fn
+// returns false. Returns ErrNotFound if no lines match.
+//
+// Each is a zero-copy alternative to Lines for performance-critical code:
+// the lines passed to fn point directly into the Searcher's mmapped data,
+// so they must not be modified, and are only valid until the Searcher is
+// closed (copy them if they need to be retained beyond that). They are
+// also never reversed (see SearcherOptions.ReverseLines).
+func (s *Searcher) Each(key []byte, fn func(line []byte) bool) error {
+	err := s.checkIndex()
+	if err != nil {
+		return err
+	}
+	key = s.searchKey(key)
+	return s.scanIndexedLines(key, func(_ int64, line []byte) bool {
+		return fn(line)
+	})
+}
+
+// LookupMany looks up all of keys in a single forward pass over the index
+// and data, calling fn with each key and the lines beginning with it (or an
+// empty lines slice, if there are none), until fn returns false. This is
+// much more efficient than calling Lines for each key when there are many
+// keys to look up (data must be ordered by the index Comparator).
+//
+// keys are processed in sorted order, so if they are not already sorted,
+// LookupMany first sorts them (without modifying keys itself).
+//
+// Like Each, LookupMany is zero-copy: lines point directly into the
+// Searcher's mmapped data, so must not be modified, and the lines slice
+// itself is reused between calls to fn (copy anything that needs to be
+// retained beyond the call to fn).
+func (s *Searcher) LookupMany(keys [][]byte, fn func(key []byte, lines [][]byte) bool) error {
+	err := s.checkIndex()
+	if err != nil {
+		return err
+	}
+
+	search := keys
+	if s.Index.KeysReversed {
+		search = make([][]byte, len(keys))
+		for i, key := range keys {
+			search[i] = s.searchKey(key)
+		}
+	}
+
+	// If search keys are unsorted, process them via a sorted permutation
+	var order []int
+	if !sort.SliceIsSorted(search, func(i, j int) bool {
+		return s.Index.compare(search[i], search[j]) < 0
+	}) {
+		order = make([]int, len(search))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return s.Index.compare(search[order[i]], search[order[j]]) < 0
+		})
+	}
+
+	// Since keys are sorted, the first line with a key >= the previous
+	// key is always a valid starting point for the next one, so we only
+	// ever move forward through the index and data
+	e := 0
+	offset := s.dataOffset()
+	var lines [][]byte
+	for i := range search {
+		if order != nil {
+			i = order[i]
+		}
+		key := search[i]
+
+		// Skip forward to key's index block if beyond our current offset
+		e = s.Index.blockEntryFrom(key, e)
+		if s.Index.List[e].Offset > offset {
+			offset = s.Index.List[e].Offset
+		}
+
+		// Skip lines with a key < ours
+		for offset < s.l {
+			line, next := s.lineAt(offset)
+			if s.Index.compare(s.Index.lineKey(line), key) >= 0 {
+				break
+			}
+			offset = next
+		}
+
+		// Collect matching lines (without advancing offset, so that
+		// repeated keys also match)
+		lines = lines[:0]
+		for o := offset; o < s.l; {
+			line, next := s.lineAt(o)
+			cmp := s.Index.keyCompare(s.Index.lineKey(line), key)
+			if cmp > 0 {
+				break
+			}
+			if cmp == 0 {
+				lines = append(lines, line)
+			}
+			o = next
+		}
+
+		if !fn(keys[i], lines) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// LinePosition returns a Match for the first line in the reader that begins
+// with key, using a binary search (data must be ordered by the index
+// Comparator). If the MatchLE option is set, LinePosition instead returns
+// the first line with the greatest key less-than-or-equal-to key (see
+// Floor).
+func (s *Searcher) LinePosition(key []byte) (Match, error) {
+	key = s.searchKey(key)
+	if s.matchLE && s.intervalEnd == 0 {
+		offset, err := s.floorOffset(key)
 		if err != nil {
-			return [][]byte{}, err
+			return Match{}, err
+		}
+		line, _ := s.lineAt(offset)
+		return s.newMatch(offset, line), nil
+	}
+
+	matches, err := s.matchesN(key, 1)
+	if err != nil {
+		return Match{}, err
+	}
+	return matches[0], nil
+}
+
+// Matches returns a Match for each line in the reader that begins with key,
+// using a binary search (data must be ordered by the index Comparator).
+func (s *Searcher) Matches(key []byte) ([]Match, error) {
+	return s.matchesN(s.searchKey(key), 0)
+}
+
+// matchesN returns Matches for the first n lines in the reader that begin
+// with key (or all of them, if n is 0).
+func (s *Searcher) matchesN(key []byte, n int) ([]Match, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return []Match{}, err
+	}
+
+	// If keys are unique max(n) is 1
+	if n == 0 && s.Index.uniqueKey(key) {
+		n = 1
+	}
+
+	var matches []Match
+	err = s.scanIndexedLines(key, func(offset int64, line []byte) bool {
+		if len(matches) == 0 || s.Index.multiLine() {
+			matches = append(matches, s.newMatch(offset, line))
+			return n <= 0 || len(matches) < n
+		}
+		// Matching lines are consecutive, so we only need to count lines
+		// for the first one
+		m := s.newMatchN(offset, line, matches[0].LineNumber+int64(len(matches)))
+		matches = append(matches, m)
+		return n <= 0 || len(matches) < n
+	})
+	return matches, err
+}
+
+// PrefixLines returns the first n lines in the reader whose keys begin with
+// prefix (or all of them, if n is 0), using a binary search (data must be
+// ordered by the index Comparator). Unlike Lines, matches are not bounded
+// by the delimiter, so e.g. a prefix of "alstom.c" matches both "alstom.ca"
+// and "alstom.com" keys.
+func (s *Searcher) PrefixLines(prefix []byte, n int) ([][]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return [][]byte{}, err
+	}
+	prefix = s.searchKey(prefix)
+
+	var lines [][]byte
+	offset := s.seekPrefix(prefix)
+	for offset < s.l {
+		line, next := s.lineAt(offset)
+		if !s.Index.hasPrefix(s.Index.lineKey(line), prefix) {
+			break
+		}
+		lines = append(lines, s.copyLine(line))
+		if n > 0 && len(lines) >= n {
+			break
+		}
+		offset = next
+	}
+
+	if len(lines) == 0 {
+		return lines, ErrNotFound
+	}
+	return lines, nil
+}
+
+// Floor returns the first line in the reader with the greatest key
+// less-than-or-equal-to key, using a binary search (data must be ordered by
+// the index Comparator). This is useful with range tables, for finding the
+// range-start line covering key. If all keys are greater than key, returns
+// ErrNotFound.
+func (s *Searcher) Floor(key []byte) ([]byte, error) {
+	offset, err := s.floorOffset(s.searchKey(key))
+	if err != nil {
+		return []byte{}, err
+	}
+	line, _ := s.lineAt(offset)
+	return s.copyLine(line), nil
+}
+
+// Ceiling returns the first line in the reader with a key
+// greater-than-or-equal-to key, using a binary search (data must be ordered
+// by the index Comparator). If all keys are less than key, returns
+// ErrNotFound.
+func (s *Searcher) Ceiling(key []byte) ([]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return []byte{}, err
+	}
+	offset := s.seekOffset(s.searchKey(key), false)
+	if offset >= s.l {
+		return []byte{}, ErrNotFound
+	}
+	line, _ := s.lineAt(offset)
+	return s.copyLine(line), nil
+}
+
+// LongestPrefix returns the first line in the reader whose key is the
+// longest prefix of query (e.g. for routing tables, or for suffix lookups
+// on KeysReversed datasets), using a binary search (data must be ordered by
+// the index Comparator). If no key is a prefix of query, returns
+// ErrNotFound. Results are only meaningful for prefix-compatible
+// comparators (see Comparator).
+func (s *Searcher) LongestPrefix(query []byte) ([]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return []byte{}, err
+	}
+	query = s.searchKey(query)
+
+	// The floor of query is either a prefix of query, or shares a common
+	// prefix with it that any shorter matching key must also be a prefix
+	// of. So rather than trying every truncation of query, we can skip
+	// straight to the floor of that common prefix, and repeat.
+	// (The floor is found using plain key comparisons, since composite
+	// keys beginning with query are not prefixes of it.)
+	for {
+		offset := s.prevLineOffset(s.seekAfter(query))
+		if offset == -1 {
+			return []byte{}, ErrNotFound
+		}
+		line, _ := s.lineAt(offset)
+		key := s.Index.lineKey(line)
+		if s.Index.hasPrefix(query, key) {
+			// If keys may be repeated, seek back to the first instance
+			if !s.Index.KeysUnique {
+				offset = s.seekOffset(key, false)
+				line, _ = s.lineAt(offset)
+			}
+			return s.copyLine(line), nil
+		}
+		if len(query) == 0 {
+			return []byte{}, ErrNotFound
+		}
+		// Comparators that aren't prefix-compatible (e.g. Numeric) may
+		// leave query unchanged, so make sure it always shrinks
+		c := s.Index.commonPrefix(key, query)
+		if c >= len(query) {
+			c = len(query) - 1
+		}
+		query = query[:c]
+	}
+}
+
+// Neighbors returns up to before lines with keys less than key, and up to
+// after lines with keys greater than key, using a binary search (data must
+// be ordered by the index Comparator). The lines are those either side of
+// where key is (or would be, if missing) in the dataset, in dataset order,
+// and exclude any lines with key itself (see Lines).
+func (s *Searcher) Neighbors(key []byte, before, after int) ([][]byte, [][]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return [][]byte{}, [][]byte{}, err
+	}
+	key = s.searchKey(key)
+
+	blines := [][]byte{}
+	offset := s.seekOffset(key, false)
+	for len(blines) < before {
+		offset = s.prevLineOffset(offset)
+		if offset == -1 {
+			break
+		}
+		line, _ := s.lineAt(offset)
+		blines = append(blines, s.copyLine(line))
+	}
+	// blines are in reverse order - flip them
+	for i, j := 0, len(blines)-1; i < j; i, j = i+1, j-1 {
+		blines[i], blines[j] = blines[j], blines[i]
+	}
+
+	alines := [][]byte{}
+	offset = s.seekOffset(key, true)
+	for offset < s.l && len(alines) < after {
+		line, next := s.lineAt(offset)
+		alines = append(alines, s.copyLine(line))
+		offset = next
+	}
+
+	return blines, alines, nil
+}
+
+// Nth returns the i-th (0-based) data line in the reader (i.e. not counting
+// any header), using the index block line counts to jump directly to the
+// block containing it. Returns ErrNotFound if i is out of range.
+func (s *Searcher) Nth(i int) ([]byte, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return []byte{}, err
+	}
+
+	ranks := s.blockRanks()
+	if i < 0 || i >= ranks[len(ranks)-1] {
+		return []byte{}, ErrNotFound
+	}
+	var offset int64
+	if rl := s.Index.recordLength(); rl > 0 {
+		// Fixed-length records can be located directly
+		offset = s.dataOffset() + int64(i)*rl
+	} else {
+		// Find the last block starting at or before line i, and skip forward
+		e := sort.Search(len(ranks), func(j int) bool { return ranks[j] > i }) - 1
+		offset = s.Index.List[e].Offset
+		for n := ranks[e]; n < i; n++ {
+			_, offset = s.lineAt(offset)
+		}
+	}
+	line, _ := s.lineAt(offset)
+	return s.copyLine(line), nil
+}
+
+// Rank returns the number of data lines in the reader with keys less than
+// key, using a binary search (data must be ordered by the index
+// Comparator). Rank is the complement of Nth i.e. Nth(Rank(key)) returns
+// the first line with a key greater-than-or-equal-to key (if any).
+func (s *Searcher) Rank(key []byte) (int, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return 0, err
+	}
+	return s.rankAt(s.seekOffset(s.searchKey(key), false)), nil
+}
+
+// floorOffset returns the offset of the first line with the greatest key
+// less-than-or-equal-to key, or ErrNotFound if all keys are greater.
+func (s *Searcher) floorOffset(key []byte) (int64, error) {
+	err := s.checkIndex()
+	if err != nil {
+		return -1, err
+	}
+	// Find the last line with a key <= key
+	offset := s.prevLineOffset(s.seekOffset(key, true))
+	if offset == -1 {
+		return -1, ErrNotFound
+	}
+	// If keys may be repeated, seek back to the first instance of this one
+	if !s.Index.KeysUnique {
+		line, _ := s.lineAt(offset)
+		offset = s.seekOffset(s.Index.lineKey(line), false)
+	}
+	return offset, nil
+}
+
+// searchKey returns key transformed as required for searching the dataset
+// i.e. reversed for KeysReversed datasets (and otherwise unchanged).
+func (s *Searcher) searchKey(key []byte) []byte {
+	if key == nil || s.Index == nil || !s.Index.KeysReversed {
+		return key
+	}
+	return reverseBytes(key)
+}
+
+// copyLine returns a copy of line for returning to callers (reversed, if
+// the ReverseLines option is set on a KeysReversed dataset).
+func (s *Searcher) copyLine(line []byte) []byte {
+	if s.reverseLines && s.Index.KeysReversed {
+		return reverseBytes(line)
+	}
+	return clonebs(line)
+}
+
+// checkIndex ensures s.Index is set. If no index exists, it builds and uses
+// a temporary one (but doesn't write it).
+func (s *Searcher) checkIndex() error {
+	if s.Index != nil {
+		return nil
+	}
+	index, err := NewIndex(s.filepath)
+	if err != nil {
+		return err
+	}
+	s.Index = index
+	return nil
+}
+
+// blockEntry returns the index entry (and its position in the index List)
+// for the block from which a forward scan for the first line with a key
+// greater-than-or-equal-to key should begin.
+func (s *Searcher) blockEntry(key []byte) (int, IndexEntry) {
+	if !s.Index.KeysIndexFirst {
+		return s.Index.blockEntryLT(key)
+	}
+	e, entry, err := s.Index.blockEntryLE(key)
+	if err != nil {
+		// All index keys are greater than key, so begin with the first
+		return 0, s.Index.List[0]
+	}
+	return e, entry
+}
+
+// seekOffset returns the offset of the first line with a key matching or
+// following key (or if exclusive is set, the first line following all those
+// matching key), ordered as by Index.keyCompare, or s.l if no such line
+// exists.
+func (s *Searcher) seekOffset(key []byte, exclusive bool) int64 {
+	if exclusive {
+		return s.seekFunc(key, func(k []byte) bool { return s.Index.keyCompare(k, key) > 0 })
+	}
+	return s.seekFunc(key, func(k []byte) bool { return s.Index.keyCompare(k, key) >= 0 })
+}
+
+// seekPrefix returns the offset of the first line with a key
+// greater-than-or-equal-to prefix (using plain key comparisons, so that
+// composite keys like "foo!,x" are found for a prefix of "foo"), or s.l if
+// no such line exists.
+func (s *Searcher) seekPrefix(prefix []byte) int64 {
+	return s.seekFunc(prefix, func(k []byte) bool { return s.Index.compare(k, prefix) >= 0 })
+}
+
+// seekAfter returns the offset of the first line with a key greater than
+// key (unlike an exclusive seekOffset, composite keys beginning with key
+// don't match it), or s.l if no such line exists.
+func (s *Searcher) seekAfter(key []byte) int64 {
+	return s.seekFunc(key, func(k []byte) bool { return s.Index.compare(k, key) > 0 })
+}
+
+// seekFunc returns the offset of the first line (at or after the block
+// for key) whose key satisfies found, or s.l if no such line exists.
+func (s *Searcher) seekFunc(key []byte, found func(k []byte) bool) int64 {
+	// Fixed-length records can be binary searched directly
+	if rl := s.Index.recordLength(); rl > 0 {
+		start := s.dataOffset()
+		n := sort.Search(int((s.l-start)/rl), func(n int) bool {
+			line, _ := s.lineAt(start + int64(n)*rl)
+			return found(s.Index.lineKey(line))
+		})
+		return start + int64(n)*rl
+	}
+
+	_, entry := s.blockEntry(key)
+	offset := entry.Offset
+	for offset < s.l {
+		line, next := s.lineAt(offset)
+		if found(s.Index.lineKey(line)) {
+			break
 		}
-		s.Index = index
+		offset = next
+	}
+	return offset
+}
+
+// newMatch returns a Match for the line at offset.
+func (s *Searcher) newMatch(offset int64, line []byte) Match {
+	var lineNumber int64
+	if s.lineNumbers {
+		lineNumber = s.lineNumber(offset)
+	}
+	return s.newMatchN(offset, line, lineNumber)
+}
+
+// newMatchN returns a Match for the line at offset, which is known to
+// have line number lineNumber.
+func (s *Searcher) newMatchN(offset int64, line []byte, lineNumber int64) Match {
+	m := Match{Offset: offset}
+	m.Line = clonebs(line)
+	m.Key = s.Index.lineKey(m.Line)
+	if s.reverseLines && s.Index.KeysReversed {
+		m.Line = reverseBytes(m.Line)
+		m.Key = reverseBytes(m.Key)
 	}
+	if s.lineNumbers {
+		m.LineNumber = lineNumber
+	}
+	return m
+}
+
+// lineNumber returns the (1-based) line number in the dataset file of the
+// line beginning at offset.
+func (s *Searcher) lineNumber(offset int64) int64 {
+	if s.Index.multiLine() {
+		// Records may span lines, so count actual newlines
+		return int64(bytes.Count(s.mmap[:offset], []byte{'\n'})) + 1
+	}
+	return int64(s.countLines(0, s.dataOffset())+s.rankAt(offset)) + 1
+}
 
-	return s.scanIndexedLines(key, n)
+// rankAt returns the number of data lines preceding offset (which must be
+// the start of a data line, or s.l).
+func (s *Searcher) rankAt(offset int64) int {
+	e := s.Index.blockEntryAt(offset)
+	return s.blockRanks()[e] + s.countLines(s.Index.List[e].Offset, offset)
+}
+
+// blockRanks returns the cumulative line counts of the index blocks i.e.
+// the number of data lines preceding each block (plus a final element with
+// the total number of data lines). These are derived from the index block
+// line counts, or for pre-version 5 indices (which lack them), by counting
+// the lines in each block on first use. Safe for concurrent use.
+func (s *Searcher) blockRanks() []int {
+	s.ranksOnce.Do(func() {
+		list := s.Index.List
+		ranks := make([]int, len(list)+1)
+		for e, entry := range list {
+			lines := entry.Lines
+			if s.Index.Version < 5 {
+				end := s.l
+				if e+1 < len(list) {
+					end = list[e+1].Offset
+				}
+				lines = s.countLines(entry.Offset, end)
+			}
+			ranks[e+1] = ranks[e] + lines
+		}
+		s.ranks = ranks
+	})
+	return s.ranks
+}
+
+// countLines returns the number of lines (records) in s.mmap between
+// offsets from and to (where from is the start of a line, and to is either
+// the start of a line or s.l).
+func (s *Searcher) countLines(from, to int64) int {
+	if rl := s.Index.recordLength(); rl > 0 {
+		return int((to - from) / rl)
+	}
+	if s.Index.multiLine() {
+		count := 0
+		for from < to {
+			_, from = s.lineAt(from)
+			count++
+		}
+		return count
+	}
+	count := bytes.Count(s.mmap[from:to], []byte{'\n'})
+	// Include any unterminated last line
+	if to == s.l && to > from && s.mmap[to-1] != '\n' {
+		count++
+	}
+	return count
+}
+
+// dataOffset returns the offset of the first data line in s.mmap
+// (i.e. skipping any header).
+func (s *Searcher) dataOffset() int64 {
+	return s.Index.List[0].Offset
+}
+
+// prevLineOffset returns the offset of the line preceding the one beginning
+// at offset (where offset may also be s.l, referring to the end of the data),
+// or -1 if offset refers to the first data line.
+func (s *Searcher) prevLineOffset(offset int64) int64 {
+	start := s.dataOffset()
+	if offset <= start {
+		return -1
+	}
+	if rl := s.Index.recordLength(); rl > 0 {
+		return offset - rl
+	}
+	if s.Index.multiLine() {
+		// We can't scan backwards through quoted fields, so scan forward
+		// from the start of the (record-aligned) preceding index block
+		prev := int64(-1)
+		o := s.Index.List[s.Index.blockEntryAt(offset-1)].Offset
+		for o < offset {
+			prev = o
+			_, o = s.lineAt(o)
+		}
+		return prev
+	}
+	// Skip the newline terminating the previous line (if any - the last
+	// line may be unterminated)
+	end := offset
+	if s.mmap[end-1] == '\n' {
+		end--
+	}
+	return start + int64(bytes.LastIndexByte(s.mmap[start:end], '\n')) + 1
+}
+
+// lineAt returns the line beginning at offset in s.mmap (without its
+// trailing newline), and the offset of the line following it. For
+// MultiLine datasets, lines are whole records, which may contain newlines,
+// and for fixed-length record datasets, lines are records.
+func (s *Searcher) lineAt(offset int64) ([]byte, int64) {
+	if rl := s.Index.recordLength(); rl > 0 {
+		return s.mmap[offset : offset+rl], offset + rl
+	}
+	buf := s.mmap[offset:]
+	var nlidx int
+	if s.Index.multiLine() {
+		nlidx = s.Index.recordEnd(buf, true)
+	} else {
+		nlidx = bytes.IndexByte(buf, '\n')
+	}
+	if nlidx == -1 {
+		return buf, s.l
+	}
+	return buf[:nlidx], offset + int64(nlidx) + 1
 }
 
 // Close closes the searcher's reader (if applicable)
@@ -260,6 +981,11 @@ func (s *Searcher) Close() {
 	if closer, ok := s.r.(io.Closer); ok {
 		closer.Close()
 	}
+	s.secondaryMu.Lock()
+	defer s.secondaryMu.Unlock()
+	for _, sec := range s.secondary {
+		sec.Close()
+	}
 }
 
 // prefixCompare compares the initial sequence of bufa matches b
@@ -278,6 +1004,18 @@ func prefixCompare(bufa, b []byte) int {
 	return bytes.Compare(bufa[:len(b)], b)
 }
 
+// reverseBytes returns a reversed copy of b. b is reversed rune-wise,
+// so that any UTF-8 sequences remain valid.
+func reverseBytes(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := 0; i < len(b); {
+		_, size := utf8.DecodeRune(b[i:])
+		copy(r[len(b)-i-size:], b[i:i+size])
+		i += size
+	}
+	return r
+}
+
 // clonebs returns a copy of the given byte slice
 func clonebs(b []byte) []byte {
 	c := make([]byte, len(b))
@@ -2,7 +2,10 @@ package bsearch
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	//"github.com/rs/zerolog"
@@ -347,6 +350,906 @@ func TestSearcherLinesFoo(t *testing.T) {
 	}
 }
 
+// Test Searcher.PrefixLines() using testdata/alstom1.csv (no header)
+// and testdata/alstom3.csv (header, multiple blocks)
+func TestSearcherPrefixLines(t *testing.T) {
+	var tests = []struct {
+		filename   string
+		header     bool
+		prefix     string
+		n          int
+		count      int
+		first_line string
+		last_line  string
+	}{
+		{"alstom1.csv", false, "alstom.c", 0, 6, "alstom.ca,alstom.com,RED", "alstom.com.br,alstom.com,RED"},
+		{"alstom1.csv", false, "alstom.com.", 0, 2, "alstom.com.au,alstom.com,RED", "alstom.com.br,alstom.com,RED"},
+		{"alstom1.csv", false, "al", 3, 3, "alstom.ca,alstom.com,RED", "alstom.com,alstom.com,SOA"},
+		{"alstom1.csv", false, "alt", 0, 1, "alt.com,alt.com,SOA", "alt.com,alt.com,SOA"},
+		{"alstom1.csv", false, "alstom.d", 0, 0, "", ""},
+		{"alstom1.csv", false, "a", 0, 7, "alstom.ca,alstom.com,RED", "alt.com,alt.com,SOA"},
+		{"alstom3.csv", true, "alstom.c", 0, 442, "alstom.ca,first", "alstom.com.br,first"},
+		{"alstom3.csv", true, "alstom.com.", 0, 2, "alstom.com.au,first", "alstom.com.br,first"},
+	}
+
+	for _, tc := range tests {
+		ensureIndex(t, tc.filename)
+		o := SearcherOptions{Header: tc.header}
+		s, err := NewSearcherOptions("testdata/"+tc.filename, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		lines, err := s.PrefixLines([]byte(tc.prefix), tc.n)
+		if tc.count == 0 {
+			assert.Equal(t, ErrNotFound, err, tc.prefix+" returns ErrNotFound")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.count, len(lines), tc.prefix+" line count")
+		if len(lines) > 0 {
+			assert.Equal(t, tc.first_line, string(lines[0]), tc.prefix+" first_line")
+			assert.Equal(t, tc.last_line, string(lines[len(lines)-1]),
+				tc.prefix+" last_line")
+		}
+	}
+}
+
+// Test Searcher.Floor() and Searcher.Ceiling() using testdata/rdns1.csv
+// (no header, duplicate keys)
+func TestSearcherFloorCeiling(t *testing.T) {
+	var tests = []struct {
+		key     string
+		floor   string
+		ceiling string
+	}{
+		{"000.000.000.000", "",
+			"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net"},
+		{"001.000.128.000",
+			"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net",
+			"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net"},
+		{"024.066.017.001",
+			"024.066.017.000,S0106905851b9f0e0.rd.shawcable.net,202003,shawcable.net",
+			"024.073.213.000,rrcs-24-73-213-0.se.biz.rr.com,202003,rr.com"},
+		{"032.000.000.000",
+			"031.209.041.000,31-209-41-0.cust.bredband2.com,202003,bredband2.com",
+			"032.176.184.000,mobile000.mycingular.net,202003,mycingular.net"},
+		{"032.176.184.000",
+			"032.176.184.000,mobile000.mycingular.net,202003,mycingular.net",
+			"032.176.184.000,mobile000.mycingular.net,202003,mycingular.net"},
+		{"032.176.200.000",
+			"032.176.184.000,mobile000.mycingular.net,202003,mycingular.net",
+			"032.176.228.000,mobile000.mycingular.net,202003,mycingular.net"},
+		{"255.255.255.255",
+			"223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net", ""},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		line, err := s.Floor([]byte(tc.key))
+		if tc.floor == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key+" floor ErrNotFound")
+		} else {
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, tc.floor, string(line), tc.key+" floor")
+
+		line, err = s.Ceiling([]byte(tc.key))
+		if tc.ceiling == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key+" ceiling ErrNotFound")
+		} else {
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, tc.ceiling, string(line), tc.key+" ceiling")
+	}
+}
+
+// Test Searcher.Line() with MatchLE using testdata/foo.csv (header,
+// duplicate keys)
+func TestSearcherLineMatchLE(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect string
+	}{
+		{"a", ""},
+		{"bar", "bar,1"},
+		{"baz", "bar,1"},
+		{"foo", "foo,2"},
+		{"fooo", "foo,2"},
+		{"zzz", "foo,2"},
+	}
+
+	ensureIndex(t, "foo.csv")
+	s, err := NewSearcherOptions("testdata/foo.csv", SearcherOptions{MatchLE: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		line, err := s.Line([]byte(tc.key))
+		if tc.expect == "" {
+			assert.Equal(t, ErrNotFound, err, tc.key+" ErrNotFound")
+		} else {
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, tc.expect, string(line), tc.key)
+	}
+}
+
+// Test Searcher.Matches() using testdata/alstom2.csv (header)
+func TestSearcherMatches(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []Match
+	}{
+		{"alstom.ca", []Match{
+			{[]byte("alstom.ca,alstom.com,RED"), []byte("alstom.ca"), 18, 2},
+		}},
+		{"alstom.com", []Match{
+			{[]byte("alstom.com,alstom.com,SOA"), []byte("alstom.com"), 71, 4},
+			{[]byte("alstom.com,alstom.com,ULT"), []byte("alstom.com"), 97, 5},
+		}},
+		{"alstom.com.br", []Match{
+			{[]byte("alstom.com.br,alstom.com,RED"), []byte("alstom.com.br"), 152, 7},
+		}},
+		{"alstom.com.b", nil},
+	}
+
+	ensureIndex(t, "alstom2.csv")
+	o := SearcherOptions{Header: true, LineNumbers: true}
+	s, err := NewSearcherOptions("testdata/alstom2.csv", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		matches, err := s.Matches([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.key+" ErrNotFound")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expect, matches, tc.key)
+
+		m, err := s.LinePosition([]byte(tc.key))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expect[0], m, tc.key+" LinePosition")
+	}
+}
+
+// Test Searcher.LinePosition() using testdata/rdns1.csv (without LineNumbers)
+func TestSearcherLinePosition(t *testing.T) {
+	var tests = []string{
+		"001.000.128.000",
+		"024.066.017.000",
+		"032.176.184.000",
+		"223.252.003.000",
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	data, err := os.ReadFile("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range tests {
+		m, err := s.LinePosition([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, key, string(m.Key), key+" key")
+		assert.Equal(t, int64(0), m.LineNumber, key+" line number")
+		assert.Equal(t, string(m.Line), string(data[m.Offset:m.Offset+int64(len(m.Line))]),
+			key+" line at offset")
+	}
+
+	_, err = s.LinePosition([]byte("000.000.000.000"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+// Test Searcher.Each() using testdata/foo.csv (header, duplicate keys)
+func TestSearcherEach(t *testing.T) {
+	var tests = []struct {
+		key        string
+		max        int
+		count      int
+		first_line string
+		last_line  string
+	}{
+		{"bar", 0, 1, "bar,1", "bar,1"},
+		{"foo", 0, 9999, "foo,2", "foo,10000"},
+		{"foo", 10, 10, "foo,2", "foo,11"},
+		{"baz", 0, 0, "", ""},
+	}
+
+	ensureIndex(t, "foo.csv")
+	s, err := NewSearcher("testdata/foo.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		var count int
+		var first, last []byte
+		err := s.Each([]byte(tc.key), func(line []byte) bool {
+			if count == 0 {
+				first = line
+			}
+			last = line
+			count++
+			return tc.max == 0 || count < tc.max
+		})
+		if tc.count == 0 {
+			assert.Equal(t, ErrNotFound, err, tc.key+" ErrNotFound")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.count, count, tc.key+" line count")
+		assert.Equal(t, tc.first_line, string(first), tc.key+" first_line")
+		assert.Equal(t, tc.last_line, string(last), tc.key+" last_line")
+	}
+
+	// Each should not allocate
+	key := []byte("bar")
+	fn := func(line []byte) bool { return true }
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Each(key, fn)
+	})
+	assert.Equal(t, float64(0), allocs, "Each allocations")
+}
+
+// Benchmark Searcher.Each()
+func BenchmarkSearcherEach(b *testing.B) {
+	bss, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer bss.Close()
+	key := []byte("032.176.184.000")
+	var count int
+	fn := func(line []byte) bool {
+		count++
+		return true
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		count = 0
+		err := bss.Each(key, fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if count != 6 {
+			b.Fatal(fmt.Errorf("Each returned %d results, expected 6\n", count))
+		}
+	}
+}
+
+// Test Searcher.LookupMany() using testdata/rdns1.csv, comparing results
+// against Searcher.Lines()
+func TestSearcherLookupMany(t *testing.T) {
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Unsorted keys, including missing and repeated keys
+	keys := [][]byte{
+		[]byte("223.252.003.000"),
+		[]byte("001.000.128.000"),
+		[]byte("032.176.184.000"),
+		[]byte("000.000.000.000"),
+		[]byte("032.176.184.000"),
+		[]byte("024.066.017.001"),
+		[]byte("024.066.017.000"),
+		[]byte("255.255.255.255"),
+	}
+	// Plus every key in the dataset
+	it := s.Range(nil, nil)
+	for it.Next() {
+		keys = append(keys, clonebs(it.Key()))
+	}
+	assert.Nil(t, it.Err())
+
+	seen := 0
+	prevKey := []byte{}
+	err = s.LookupMany(keys, func(key []byte, lines [][]byte) bool {
+		assert.True(t, string(prevKey) <= string(key), "keys are sorted")
+		prevKey = key
+		seen++
+
+		expect, err := s.Lines(key)
+		if err == ErrNotFound {
+			assert.Equal(t, 0, len(lines), string(key)+" not found")
+			return true
+		}
+		assert.Nil(t, err)
+		got := [][]byte{}
+		for _, line := range lines {
+			got = append(got, line)
+		}
+		// Lines only returns the first line for unique keys
+		if s.Index.KeysUnique {
+			got = got[:1]
+		}
+		assert.Equal(t, expect, got, string(key))
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, len(keys), seen, "all keys processed")
+	assert.Equal(t, "223.252.003.000", string(keys[0]), "keys unmodified")
+
+	// Early termination
+	seen = 0
+	err = s.LookupMany(keys, func(key []byte, lines [][]byte) bool {
+		seen++
+		return seen < 3
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, seen, "early termination")
+}
+
+// Test Searcher methods using testdata/ca_rev.txt indexed as KeysReversed
+func TestSearcherKeysReversed(t *testing.T) {
+	writeIndexOptions(t, "ca_rev.txt", IndexOptions{Delimiter: []byte(","), KeysReversed: true})
+	s, err := NewSearcher("testdata/ca_rev.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, true, s.Index.KeysReversed)
+
+	// Search keys are reversed, but lines are returned as-is
+	lines, err := s.Lines([]byte("www.0-0.ca"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("ac.0-0.www")}, lines)
+
+	// Suffix searches via PrefixLines
+	lines, err = s.PrefixLines([]byte("tennis40-0.ca"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(lines))
+	assert.Equal(t, "ac.0-04sinnet", string(lines[0]))
+
+	count, err := s.CountRange([]byte("0-0.ca"), []byte("tennis40-0.ca"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// LookupMany returns the original (unreversed) keys
+	keys := [][]byte{[]byte("www.0-0.ca"), []byte("0-0.ca"), []byte("nosuchdomain.ca")}
+	got := map[string]int{}
+	err = s.LookupMany(keys, func(key []byte, lines [][]byte) bool {
+		got[string(key)] = len(lines)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"0-0.ca": 1, "www.0-0.ca": 1, "nosuchdomain.ca": 0}, got)
+
+	// With ReverseLines, lines are returned reversed too
+	s2, err := NewSearcherOptions("testdata/ca_rev.txt", SearcherOptions{ReverseLines: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	lines, err = s2.PrefixLines([]byte("tennis40-0.ca"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("tennis40-0.ca"), []byte("webdisk.tennis40-0.ca")}, lines)
+	m, err := s2.LinePosition([]byte("www.0-0.ca"))
+	assert.Nil(t, err)
+	assert.Equal(t, "www.0-0.ca", string(m.Line))
+	assert.Equal(t, "www.0-0.ca", string(m.Key))
+}
+
+// Test Searcher.LongestPrefix() using testdata/rdns1.csv and (reversed)
+// testdata/ca_rev.txt
+func TestSearcherLongestPrefix(t *testing.T) {
+	var tests = []struct {
+		filename string
+		query    string
+		expect   string
+	}{
+		{"rdns1.csv", "001.000.128.000", "001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net"},
+		{"rdns1.csv", "001.000.128.000.255", "001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net"},
+		{"rdns1.csv", "001.000.128.001", ""},
+		{"rdns1.csv", "000", ""},
+		{"ca_rev.txt", "www.0-0.ca", "ac.0-0.www"},
+		{"ca_rev.txt", "foo.www.0-0.ca", "ac.0-0.www"},
+		{"ca_rev.txt", "zzz.0-0.ca", "ac.0-0"},
+		{"ca_rev.txt", "mail.tennis40-0.ca", "ac.0-04sinnet"},
+		{"ca_rev.txt", "example.ca", ""},
+		{"composite.csv", "alpha,2020-02,9", "alpha,2020-02,2"},
+		{"composite.csv", "alpha,2020-01", "alpha,2020-01,1"},
+		{"composite.csv", "alpha,2020-03", ""},
+		{"composite.csv", "alpha", ""},
+		{"composite.csv", "beta,2020-01.x", "beta,2020-01,6"},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	writeIndexOptions(t, "ca_rev.txt", IndexOptions{Delimiter: []byte(","), KeysReversed: true})
+	writeIndexOptions(t, "composite.csv", IndexOptions{KeyFields: 2})
+	for _, tc := range tests {
+		s, err := NewSearcher(filepath.Join("testdata", tc.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := s.LongestPrefix([]byte(tc.query))
+		if tc.expect == "" {
+			assert.Equal(t, ErrNotFound, err, tc.query)
+		} else {
+			assert.Nil(t, err, tc.query)
+			assert.Equal(t, tc.expect, string(line), tc.query)
+		}
+		s.Close()
+	}
+}
+
+// Test Searcher.Neighbors() using testdata/rdns1.csv
+func TestSearcherNeighbors(t *testing.T) {
+	var tests = []struct {
+		key    string
+		before int
+		after  int
+		blines []string
+		alines []string
+	}{
+		{"001.040.000.000", 2, 2,
+			[]string{
+				"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net",
+				"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net",
+			},
+			[]string{
+				"001.041.142.000,n1-41-142-0.bla2.nsw.optusnet.com.au,202003,optusnet.com.au",
+				"001.065.117.000,1-65-117-000.static.netvigator.com,202003,netvigator.com",
+			}},
+		{"032.176.184.000", 1, 1,
+			[]string{"031.209.041.000,31-209-41-0.cust.bredband2.com,202003,bredband2.com"},
+			[]string{"032.176.228.000,mobile000.mycingular.net,202003,mycingular.net"}},
+		{"000", 3, 1,
+			[]string{},
+			[]string{"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net"}},
+		{"999", 1, 2,
+			[]string{"223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net"},
+			[]string{}},
+		{"001.040.000.000", 0, 0, []string{}, []string{}},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	strs := func(lines [][]byte) []string {
+		r := []string{}
+		for _, l := range lines {
+			r = append(r, string(l))
+		}
+		return r
+	}
+	for _, tc := range tests {
+		blines, alines, err := s.Neighbors([]byte(tc.key), tc.before, tc.after)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.blines, strs(blines), tc.key+" before")
+		assert.Equal(t, tc.alines, strs(alines), tc.key+" after")
+	}
+}
+
+// Test Searcher.Nth() and Searcher.Rank()
+func TestSearcherNthRank(t *testing.T) {
+	var tests = []struct {
+		filename string
+		n        int
+		line     string
+		key      string
+		rank     int
+	}{
+		{"rdns1.csv", 0, "001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net", "000", 0},
+		{"rdns1.csv", 1001, "074.132.152.000,cpe-74-132-152-0.kya.res.rr.com,202003,rr.com", "001.040", 2},
+		{"rdns1.csv", 3514, "223.252.003.000,223-252-3-0.as45671.net,202003,as45671.net", "999", 3515},
+		{"rdns1.csv", 3515, "", "032.176.184.000", 283},
+		{"rdns1.csv", -1, "", "032.176.184.001", 289},
+		{"alstom3.csv", 0, "alstom.ca,first", "alstom.com", 2},
+		{"alstom3.csv", 3, "alstom.com,second", "alstom.com.", 440},
+	}
+
+	for _, tc := range tests {
+		ensureIndex(t, tc.filename)
+		s, err := NewSearcher(filepath.Join("testdata", tc.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Check both using index line counts, and (as for pre-version 5
+		// indices) without them
+		for _, version := range []int{s.Index.Version, 4} {
+			s.Index.Version = version
+			s.ranks, s.ranksOnce = nil, sync.Once{}
+
+			line, err := s.Nth(tc.n)
+			if tc.line == "" {
+				assert.Equal(t, ErrNotFound, err, fmt.Sprintf("%s Nth(%d)", tc.filename, tc.n))
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.line, string(line), fmt.Sprintf("%s Nth(%d)", tc.filename, tc.n))
+			}
+
+			rank, err := s.Rank([]byte(tc.key))
+			assert.Nil(t, err)
+			assert.Equal(t, tc.rank, rank, fmt.Sprintf("%s Rank(%q)", tc.filename, tc.key))
+		}
+		s.Close()
+	}
+}
+
+// Test concurrent Rank/Nth calls on a fresh Searcher (run with -race)
+func TestSearcherRankConcurrent(t *testing.T) {
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rank, err := s.Rank([]byte("223.252.003.000"))
+			assert.Nil(t, err)
+			assert.Equal(t, 3514, rank)
+			line, err := s.Nth(1001)
+			assert.Nil(t, err)
+			assert.Equal(t, "074.132.152.000,cpe-74-132-152-0.kya.res.rr.com,202003,rr.com", string(line))
+		}()
+	}
+	wg.Wait()
+}
+
+// Test composite key searches using testdata/composite.csv (sorted on the
+// first two fields)
+func TestSearcherKeyFields(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"alpha", []string{"alpha,2020-01,1", "alpha,2020-02,2", "alpha,2020-02,3"}},
+		{"alpha,2020-02", []string{"alpha,2020-02,2", "alpha,2020-02,3"}},
+		{"alpha+beta", []string{"alpha+beta,2020-01,4"}},
+		{"alpha.com,2020-01", []string{"alpha.com,2020-01,5"}},
+		{"beta", []string{"beta,2020-01,6"}},
+		{"alpha,2020", nil},
+		{"alpha,2020-03", nil},
+		{"alph", nil},
+	}
+
+	writeIndexOptions(t, "composite.csv", IndexOptions{KeyFields: 2})
+	s, err := NewSearcher("testdata/composite.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, 2, s.Index.KeyFields)
+	assert.Equal(t, false, s.Index.KeysUnique)
+
+	keys := [][]byte{}
+	for _, tc := range tests {
+		keys = append(keys, []byte(tc.key))
+
+		lines, err := s.Lines([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+			continue
+		}
+		assert.Nil(t, err, tc.key)
+		got := []string{}
+		for _, l := range lines {
+			got = append(got, string(l))
+		}
+		assert.Equal(t, tc.expect, got, tc.key)
+
+		count, err := s.Count([]byte(tc.key))
+		assert.Nil(t, err)
+		assert.Equal(t, len(tc.expect), count, tc.key+" count")
+	}
+
+	// LookupMany should give the same results
+	err = s.LookupMany(keys, func(key []byte, lines [][]byte) bool {
+		for _, tc := range tests {
+			if tc.key == string(key) {
+				assert.Equal(t, len(tc.expect), len(lines), tc.key+" LookupMany")
+			}
+		}
+		return true
+	})
+	assert.Nil(t, err)
+
+	// "alpha+beta" sorts between "alpha" and "alpha,", so precedes lines
+	// matching "alpha", and both bounds must agree on that
+	before, after, err := s.Neighbors([]byte("alpha"), 2, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("alpha+beta,2020-01,4")}, before, "Neighbors alpha before")
+	assert.Equal(t, [][]byte{[]byte("alpha.com,2020-01,5")}, after, "Neighbors alpha after")
+	rank, err := s.Rank([]byte("alpha"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, rank, "Rank alpha")
+	line, err := s.Ceiling([]byte("alpha"))
+	assert.Nil(t, err)
+	assert.Equal(t, "alpha,2020-01,1", string(line), "Ceiling alpha")
+	lines, err := s.PrefixLines([]byte("alpha"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(lines), "PrefixLines alpha")
+}
+
+// Test composite key searches using testdata/composite_unique.csv, whose
+// composite keys are unique (but leading fields are not)
+func TestSearcherKeyFieldsUnique(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"example.com", []string{"example.com,2020-01,1", "example.com,2020-02,2"}},
+		{"example.com,2020-02", []string{"example.com,2020-02,2"}},
+		{"foo.com", []string{"foo.com,2020-01,3"}},
+	}
+
+	writeIndexOptions(t, "composite_unique.csv", IndexOptions{KeyFields: 2})
+	s, err := NewSearcher("testdata/composite_unique.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, true, s.Index.KeysUnique)
+
+	for _, tc := range tests {
+		lines, err := s.Lines([]byte(tc.key))
+		assert.Nil(t, err, tc.key)
+		got := []string{}
+		for _, l := range lines {
+			got = append(got, string(l))
+		}
+		assert.Equal(t, tc.expect, got, tc.key)
+
+		matches, err := s.Matches([]byte(tc.key))
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, len(tc.expect), len(matches), tc.key+" matches")
+
+		count, err := s.Count([]byte(tc.key))
+		assert.Nil(t, err)
+		assert.Equal(t, len(tc.expect), count, tc.key+" count")
+	}
+}
+
+// Test searching on a key column other than the first using
+// testdata/alstom_parent.csv (sorted on its second, parent, column)
+func TestSearcherKeyColumn(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"alstom.com", []string{"www.alstom.com,alstom.com,RED",
+			"alstom.ca,alstom.com,RED", "alstom.com,alstom.com,SOA"}},
+		{"alstom.de", []string{"shop.alstom.de,alstom.de,RED", "alstom.de,alstom.de,SOA"}},
+		{"alt.com", []string{"alt.com,alt.com,SOA"}},
+		{"alstom.ca", nil},
+		{"www.alstom.com", nil},
+	}
+
+	// The dataset is not sorted on its first or third columns
+	for _, opt := range []IndexOptions{{Header: true}, {KeyColumnName: "src"}} {
+		_, err := NewIndexOptions("testdata/alstom_parent.csv", opt)
+		assert.NotNil(t, err, "sort violation")
+	}
+	_, err := NewIndexOptions("testdata/alstom_parent.csv",
+		IndexOptions{KeyColumnName: "apex"})
+	assert.Equal(t, ErrKeyColumnNotFound, err)
+
+	for _, opt := range []IndexOptions{
+		{Header: true, KeyColumn: 1},
+		{KeyColumnName: "parent"},
+	} {
+		writeIndexOptions(t, "alstom_parent.csv", opt)
+		s, err := NewSearcherOptions("testdata/alstom_parent.csv",
+			SearcherOptions{KeyColumnName: "parent"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, s.Index.KeyColumn)
+
+		for _, tc := range tests {
+			lines, err := s.Lines([]byte(tc.key))
+			if tc.expect == nil {
+				assert.Equal(t, ErrNotFound, err, tc.key)
+				continue
+			}
+			assert.Nil(t, err, tc.key)
+			got := []string{}
+			for _, l := range lines {
+				got = append(got, string(l))
+			}
+			assert.Equal(t, tc.expect, got, tc.key)
+		}
+
+		lines, err := s.Glob([]byte("alstom.*"))
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(lines), "glob alstom.*")
+		s.Close()
+	}
+
+	// Searcher options must match the index key column
+	_, err = NewSearcherOptions("testdata/alstom_parent.csv",
+		SearcherOptions{KeyColumn: 2})
+	assert.Equal(t, ErrIndexKeyColumnMismatch, err)
+}
+
+// Test that NewSearcherOptions doesn't leak file descriptors when the
+// index doesn't match the options
+func TestSearcherOptionsMismatch(t *testing.T) {
+	writeIndexOptions(t, "alstom_parent.csv", IndexOptions{KeyColumnName: "parent"})
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("cannot count open file descriptors")
+	}
+
+	for _, opt := range []SearcherOptions{
+		{KeyColumn: 2},
+		{KeyColumnName: "src"},
+		{Dialect: &RFC4180},
+		{WholeLine: true},
+		{FixedWidth: &FixedWidth{KeyLength: 6}},
+	} {
+		_, err := NewSearcherOptions("testdata/alstom_parent.csv", opt)
+		assert.NotNil(t, err, fmt.Sprintf("%+v", opt))
+	}
+
+	fds2, err := os.ReadDir("/proc/self/fd")
+	assert.Nil(t, err)
+	assert.Equal(t, len(fds), len(fds2), "open file descriptors")
+}
+
+// Test whole-line key (word list) searches using testdata/words.lst and
+// testdata/words (the same list, without an extension)
+func TestSearcherWholeLine(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"apple", []string{"apple"}},
+		{"apple\tred", []string{"apple\tred"}},
+		{"apple pie", []string{"apple pie"}},
+		{"apple,green", []string{"apple,green"}},
+		{"banana", []string{"banana", "banana"}},
+		{"appl", nil},
+		{"apple pi", nil},
+	}
+
+	_, err := NewIndexOptions("testdata/words.lst",
+		IndexOptions{WholeLine: true, Delimiter: []byte(",")})
+	assert.Equal(t, ErrWholeLineOptions, err)
+
+	for _, filename := range []string{"words.lst", "words"} {
+		// Word lists default to whole-line keys
+		writeIndexOptions(t, filename, IndexOptions{})
+		s, err := NewSearcherOptions(filepath.Join("testdata", filename),
+			SearcherOptions{WholeLine: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, true, s.Index.WholeLine, filename)
+		assert.Equal(t, "", string(s.Index.Delimiter), filename)
+
+		for _, tc := range tests {
+			lines, err := s.Lines([]byte(tc.key))
+			if tc.expect == nil {
+				assert.Equal(t, ErrNotFound, err, tc.key)
+				continue
+			}
+			assert.Nil(t, err, tc.key)
+			got := []string{}
+			for _, l := range lines {
+				got = append(got, string(l))
+			}
+			assert.Equal(t, tc.expect, got, tc.key)
+		}
+
+		// Prefix and range lookups, like look(1)
+		lines, err := s.PrefixLines([]byte("apple"), 0)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(lines), filename+" PrefixLines apple")
+		line, err := s.Floor([]byte("apricot"))
+		assert.Nil(t, err)
+		assert.Equal(t, "apples", string(line), filename+" Floor apricot")
+		line, err = s.Ceiling([]byte("apple!"))
+		assert.Nil(t, err)
+		assert.Equal(t, "apple,green", string(line), filename+" Ceiling apple!")
+		s.Close()
+	}
+
+	// .txt files also default to whole-line keys
+	idx, err := NewIndex("testdata/ca_rev.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, true, idx.WholeLine, "ca_rev.txt")
+
+	// Searcher options must match the index
+	ensureIndex(t, "alstom1.csv")
+	_, err = NewSearcherOptions("testdata/alstom1.csv",
+		SearcherOptions{WholeLine: true})
+	assert.Equal(t, ErrIndexWholeLineMismatch, err)
+}
+
+// writeIndexOptions (re)writes the index for testdata/filename using opt
+func writeIndexOptions(t *testing.T, filename string, opt IndexOptions) {
+	t.Helper()
+	idx, err := NewIndexOptions(filepath.Join("testdata", filename), opt)
+	if err != nil {
+		t.Fatalf("writeIndexOptions NewIndexOptions %s: %s\n", filename, err.Error())
+	}
+	err = idx.Write()
+	if err != nil {
+		t.Fatalf("writeIndexOptions index Write %s: %s\n", filename, err.Error())
+	}
+}
+
+// Test Searcher.Lines() in interval mode using testdata/ipv4_ranges.csv
+func TestSearcherLinesInterval(t *testing.T) {
+	var tests = []struct {
+		key    string
+		expect []string
+	}{
+		{"001.000.000.000", []string{"001.000.000.000,001.000.000.255,AU"}},
+		{"001.000.000.128", []string{"001.000.000.000,001.000.000.255,AU"}},
+		{"001.000.003.255", []string{"001.000.001.000,001.000.003.255,CN"}},
+		{"001.000.010.000", []string{"001.000.008.000,001.000.015.255,CN"}},
+		{"002.016.100.000", []string{"002.016.000.000,002.016.127.255,FR", "002.016.000.000,002.016.255.255,EU"}},
+		{"002.016.200.000", []string{"002.016.000.000,002.016.255.255,EU"}},
+		{"005.255.255.255", []string{"005.000.000.000,005.255.255.255,US"}},
+		// Gaps
+		{"000.000.000.001", nil},
+		{"001.000.005.000", nil},
+		{"002.017.000.000", nil},
+		{"006.000.000.000", nil},
+	}
+
+	ensureIndex(t, "ipv4_ranges.csv")
+	s, err := NewSearcherOptions("testdata/ipv4_ranges.csv", SearcherOptions{IntervalEnd: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tc := range tests {
+		lines, err := s.Lines([]byte(tc.key))
+		if tc.expect == nil {
+			assert.Equal(t, ErrNotFound, err, tc.key)
+			continue
+		}
+		assert.Nil(t, err, tc.key)
+		got := []string{}
+		for _, l := range lines {
+			got = append(got, string(l))
+		}
+		assert.Equal(t, tc.expect, got, tc.key)
+
+		line, err := s.Line([]byte(tc.key))
+		assert.Nil(t, err, tc.key)
+		assert.Equal(t, tc.expect[0], string(line), tc.key)
+	}
+}
+
 // Benchmark Searcher.Lines()
 func BenchmarkSearcherLines(b *testing.B) {
 	bss, err := NewSearcher("testdata/rdns1.csv")
@@ -365,3 +1268,111 @@ func BenchmarkSearcherLines(b *testing.B) {
 		}
 	}
 }
+
+// Test Searcher.LinesBy() on the (non-key) apex domain column of
+// testdata/rdns1.csv
+func TestSearcherLinesBy(t *testing.T) {
+	var tests = []struct {
+		value      string
+		count      int
+		first_line string
+		last_line  string
+	}{
+		{"hinet.net", 59,
+			"001.034.164.000,1-34-164-0.HINET-IP.hinet.net,202003,hinet.net",
+			"223.142.175.000,223-142-175-0.emome-ip.hinet.net,202003,hinet.net"},
+		{"totinternet.net", 3,
+			"001.000.128.000,node-0.pool-1-0.dynamic.totinternet.net,202003,totinternet.net",
+			"125.025.093.000,node-idc.pool-125-25.dynamic.totinternet.net,202003,totinternet.net"},
+		{"hinet", 0, "", ""},
+	}
+
+	ensureIndex(t, "rdns1.csv")
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	secpath, _ := SecondaryPath("testdata/rdns1.csv", 3)
+	os.Remove(secpath)
+	_, err = s.LinesBy(3, []byte("hinet.net"))
+	assert.Equal(t, ErrSecondaryNotFound, err)
+
+	err = WriteSecondaryIndex("testdata/rdns1.csv", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range tests {
+		lines, err := s.LinesBy(3, []byte(tc.value))
+		if tc.count == 0 {
+			assert.Equal(t, ErrNotFound, err, tc.value+" returns ErrNotFound")
+			continue
+		}
+		assert.Nil(t, err, tc.value)
+		assert.Equal(t, tc.count, len(lines), tc.value+" line count")
+		if len(lines) > 0 {
+			assert.Equal(t, tc.first_line, string(lines[0]), tc.value+" first_line")
+			assert.Equal(t, tc.last_line, string(lines[len(lines)-1]),
+				tc.value+" last_line")
+		}
+	}
+}
+
+// Test concurrent LinesBy calls on a fresh Searcher (run with -race)
+func TestLinesByConcurrent(t *testing.T) {
+	ensureIndex(t, "rdns1.csv")
+	err := WriteSecondaryIndex("testdata/rdns1.csv", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSearcher("testdata/rdns1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lines, err := s.LinesBy(3, []byte("hinet.net"))
+			assert.Nil(t, err)
+			assert.Equal(t, 59, len(lines))
+		}()
+	}
+	wg.Wait()
+}
+
+// Test secondary indexes on testdata/multiline.csv, whose quoted fields
+// may contain newlines
+func TestLinesByMultiLine(t *testing.T) {
+	writeIndexOptions(t, "multiline.csv", IndexOptions{
+		Dialect: &Dialect{Quote: `"`, MultiLine: true},
+		Header:  true,
+	})
+
+	secpath, _ := SecondaryPath("testdata/multiline.csv", 1)
+	os.Remove(secpath)
+	err := WriteSecondaryIndex("testdata/multiline.csv", 1)
+	assert.NotNil(t, err, "column values with newlines are rejected")
+	_, err = os.Stat(secpath)
+	assert.True(t, os.IsNotExist(err), "no secondary index written")
+
+	err = WriteSecondaryIndex("testdata/multiline.csv", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSearcher("testdata/multiline.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	lines, err := s.LinesBy(2, []byte("4"))
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(lines)) {
+		assert.Equal(t, "delta,\"a \"\"quoted\"\"\nmulti\nline note\",4", string(lines[0]))
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Secondary indexes provide lookups on non-key columns for bsearch.
+
+A secondary index is a sidecar dataset for lookups on a non-key column of
+a primary dataset. Each line maps a column value to the byte offset of a
+primary line with that value ("value\toffset"), and lines are sorted by
+value, so the sidecar can itself be indexed and binary searched. The
+sidecar has the same name and location as the primary dataset, but with
+all '.' characters changed to '_', and a '_COLUMN.bss' suffix e.g. the
+secondary index on column 3 of `test_foobar.csv` is `test_foobar_csv_3.bss`.
+*/
+
+package bsearch
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	secondarySuffix    = "bss"
+	secondaryDelimiter = '\t'
+)
+
+var (
+	ErrSecondaryNotFound = errors.New("secondary index file not found")
+)
+
+// secondaryEntry is a secondary index entry, mapping a column value to the
+// offset of a primary line with that value
+type secondaryEntry struct {
+	value  []byte
+	offset int64
+}
+
+// secondaryFile returns the secondary index file for column of filename
+func secondaryFile(filename string, column int) string {
+	reDot := regexp.MustCompile(`\.`)
+	basename := reDot.ReplaceAllString(filename, "_")
+	return basename + "_" + strconv.Itoa(column) + "." + secondarySuffix
+}
+
+// SecondaryPath returns the absolute filepath of the secondary index file
+// for column (0-based) of the dataset at path
+func SecondaryPath(path string, column int) (string, error) {
+	var err error
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, base := filepath.Split(path)
+	return filepath.Join(dir, secondaryFile(base, column)), nil
+}
+
+// WriteSecondaryIndex generates and writes a secondary index (and its own
+// bsearch index) for column (0-based) of the dataset at path, for use by
+// Searcher.LinesBy. The dataset must already have an up-to-date index.
+// Lines with an empty (or missing) column value are not indexed, and
+// column values containing tabs or newlines are rejected. All column
+// values are sorted in memory, so very large datasets may need a
+// correspondingly large amount of memory.
+func WriteSecondaryIndex(path string, column int) error {
+	s, err := NewSearcher(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var entries []secondaryEntry
+	offset := s.dataOffset()
+	for offset < s.l {
+		line, next := s.lineAt(offset)
+		value := s.Index.lineField(line, column)
+		if bytes.IndexByte(value, secondaryDelimiter) > -1 {
+			return fmt.Errorf("cannot index column value %q containing delimiter %q",
+				value, secondaryDelimiter)
+		}
+		if bytes.IndexByte(value, recordSeparator) > -1 {
+			return fmt.Errorf("cannot index column value %q containing newline", value)
+		}
+		if len(value) > 0 {
+			entries = append(entries, secondaryEntry{value: value, offset: offset})
+		}
+		offset = next
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].value, entries[j].value) < 0
+	})
+
+	secpath, err := SecondaryPath(path, column)
+	if err != nil {
+		return err
+	}
+	fh, err := os.OpenFile(secpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	abort := func() { fh.Close(); os.Remove(secpath) }
+
+	writer := bufio.NewWriter(fh)
+	for _, entry := range entries {
+		_, err = fmt.Fprintf(writer, "%s%c%d%c",
+			entry.value, secondaryDelimiter, entry.offset, recordSeparator)
+		if err != nil {
+			abort()
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		abort()
+		return err
+	}
+	err = fh.Close()
+	if err != nil {
+		os.Remove(secpath)
+		return err
+	}
+
+	index, err := NewIndexOptions(secpath,
+		IndexOptions{Delimiter: []byte{secondaryDelimiter}})
+	if err != nil {
+		return err
+	}
+	return index.Write()
+}
+
+// LinesBy returns all lines in the reader whose column (0-based) field
+// equals value, in dataset order, using the secondary index for column
+// (see WriteSecondaryIndex). Returns ErrSecondaryNotFound if there is no
+// secondary index for column, ErrIndexExpired if it is older than the
+// dataset, and ErrNotFound if no lines match.
+func (s *Searcher) LinesBy(column int, value []byte) ([][]byte, error) {
+	sec, err := s.secondarySearcher(column)
+	if err != nil {
+		return [][]byte{}, err
+	}
+
+	entries, err := sec.Lines(value)
+	if err != nil {
+		return [][]byte{}, err
+	}
+
+	lines := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		d := bytes.LastIndexByte(entry, secondaryDelimiter)
+		offset, err := strconv.ParseInt(string(entry[d+1:]), 10, 64)
+		if err != nil || offset < 0 || offset >= s.l {
+			return [][]byte{}, fmt.Errorf("malformed secondary index entry %q", entry)
+		}
+		line, _ := s.lineAt(offset)
+		// Sanity check the entry still matches the dataset
+		if !bytes.Equal(s.Index.lineField(line, column), value) {
+			return [][]byte{}, ErrIndexExpired
+		}
+		lines = append(lines, s.copyLine(line))
+	}
+
+	return lines, nil
+}
+
+// secondarySearcher returns a Searcher for the secondary index for column,
+// opening it on first use. Safe for concurrent use.
+func (s *Searcher) secondarySearcher(column int) (*Searcher, error) {
+	s.secondaryMu.Lock()
+	defer s.secondaryMu.Unlock()
+	if sec, ok := s.secondary[column]; ok {
+		return sec, nil
+	}
+
+	secpath, err := SecondaryPath(s.filepath, column)
+	if err != nil {
+		return nil, err
+	}
+	se, err := epoch(secpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSecondaryNotFound
+		}
+		return nil, err
+	}
+	fe, err := epoch(s.filepath)
+	if err != nil {
+		return nil, err
+	}
+	if fe > se {
+		return nil, ErrIndexExpired
+	}
+
+	sec, err := NewSearcher(secpath)
+	if err != nil {
+		return nil, err
+	}
+	if s.secondary == nil {
+		s.secondary = make(map[int]*Searcher)
+	}
+	s.secondary[column] = sec
+	return sec, nil
+}